@@ -0,0 +1,277 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Balancer picks the endpoint of every attempt of a request among the endpoints given to RESTClient.Endpoints,
+// it is shared by the clients of a Transport
+type Balancer interface {
+	// Pick returns the endpoint to send an attempt to, the endpoints already tried by
+	// the previous attempts of the request are avoided when possible
+	Pick(endpoints []string, tried []string) string
+	// Done reports the result of the attempt sent to endpoint, for a response it is called
+	// once the body is closed, with the error reading the body if any
+	Done(endpoint string, resp *http.Response, err error)
+}
+
+// BalanceStrategy is the way a Balancer picks an endpoint
+type BalanceStrategy int
+
+const (
+	// RoundRobin picks the endpoints in turn
+	RoundRobin BalanceStrategy = iota
+	// WeightedRoundRobin picks the endpoints in turn as often as their weight
+	WeightedRoundRobin
+	// LeastInFlight picks the endpoint with the fewest requests in flight
+	LeastInFlight
+	// PowerOfTwoChoices picks the endpoint with the fewest requests in flight among two random ones
+	PowerOfTwoChoices
+)
+
+// BalancerOption configures the balancer created by NewBalancer
+type BalancerOption func(*balancer)
+
+// WithWeights sets the weights of the endpoints for WeightedRoundRobin, an endpoint weighs 1 by default
+func WithWeights(weights map[string]int) BalancerOption {
+	return func(b *balancer) {
+		b.weights = weights
+	}
+}
+
+// WithUnhealthyTimeout sets how long an endpoint is avoided after a connection error, 10s by default
+func WithUnhealthyTimeout(timeout time.Duration) BalancerOption {
+	return func(b *balancer) {
+		b.unhealthyTimeout = timeout
+	}
+}
+
+// NewBalancer returns a Balancer picking the endpoints by strategy, the endpoints failing
+// with a connection error are avoided for a while
+func NewBalancer(strategy BalanceStrategy, opts ...BalancerOption) Balancer {
+	b := &balancer{
+		strategy:         strategy,
+		unhealthyTimeout: 10 * time.Second,
+		now:              time.Now,
+		endpoints:        make(map[string]*endpointState),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// defaultBalancer is used by the transports without balancer
+var defaultBalancer = NewBalancer(RoundRobin)
+
+type balancer struct {
+	strategy         BalanceStrategy
+	weights          map[string]int
+	unhealthyTimeout time.Duration
+	now              func() time.Time
+
+	mu        sync.Mutex
+	next      int
+	endpoints map[string]*endpointState
+}
+
+type endpointState struct {
+	inFlight       int
+	currentWeight  int
+	unhealthyUntil time.Time
+}
+
+func (b *balancer) Pick(endpoints []string, tried []string) string {
+	if len(endpoints) == 0 {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	candidates := b.candidates(endpoints, tried)
+	var picked string
+	switch b.strategy {
+	case WeightedRoundRobin:
+		picked = b.pickWeighted(candidates)
+	case LeastInFlight:
+		picked = b.pickLeastInFlight(candidates)
+	case PowerOfTwoChoices:
+		picked = b.pickTwoChoices(candidates)
+	default:
+		picked = candidates[b.next%len(candidates)]
+		b.next++
+	}
+	b.state(picked).inFlight++
+	return picked
+}
+
+func (b *balancer) Done(endpoint string, _ *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state(endpoint)
+	if state.inFlight > 0 {
+		state.inFlight--
+	}
+	if isConnectionError(err) {
+		state.unhealthyUntil = b.now().Add(b.unhealthyTimeout)
+	}
+}
+
+// candidates returns the healthy endpoints which are not tried yet, or all of them if there is none
+func (b *balancer) candidates(endpoints []string, tried []string) []string {
+	untried := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !containsString(tried, endpoint) {
+			untried = append(untried, endpoint)
+		}
+	}
+	if len(untried) == 0 {
+		untried = endpoints
+	}
+	now := b.now()
+	healthy := make([]string, 0, len(untried))
+	for _, endpoint := range untried {
+		if !now.Before(b.state(endpoint).unhealthyUntil) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	if len(healthy) == 0 {
+		return untried
+	}
+	return healthy
+}
+
+// pickWeighted is the smooth weighted round-robin of nginx
+func (b *balancer) pickWeighted(candidates []string) string {
+	var (
+		total int
+		best  *endpointState
+		index int
+	)
+	for i, endpoint := range candidates {
+		weight, ok := b.weights[endpoint]
+		if !ok {
+			weight = 1
+		}
+		state := b.state(endpoint)
+		state.currentWeight += weight
+		total += weight
+		if best == nil || state.currentWeight > best.currentWeight {
+			best, index = state, i
+		}
+	}
+	best.currentWeight -= total
+	return candidates[index]
+}
+
+func (b *balancer) pickLeastInFlight(candidates []string) string {
+	// start from a rotating offset, so that the ties are spread over the endpoints
+	offset := b.next % len(candidates)
+	b.next++
+	picked := candidates[offset]
+	for i := 1; i < len(candidates); i++ {
+		endpoint := candidates[(offset+i)%len(candidates)]
+		if b.state(endpoint).inFlight < b.state(picked).inFlight {
+			picked = endpoint
+		}
+	}
+	return picked
+}
+
+func (b *balancer) pickTwoChoices(candidates []string) string {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	if b.state(candidates[j]).inFlight < b.state(candidates[i]).inFlight {
+		return candidates[j]
+	}
+	return candidates[i]
+}
+
+func (b *balancer) state(endpoint string) *endpointState {
+	state, ok := b.endpoints[endpoint]
+	if !ok {
+		state = &endpointState{}
+		b.endpoints[endpoint] = state
+	}
+	return state
+}
+
+type endpointAttemptKey struct{}
+
+// endpointAttempt is the endpoint picked for an attempt of a request with several endpoints, it is in the
+// context of the attempt so that a RoundTripper can send a copy of the attempt to another endpoint
+type endpointAttempt struct {
+	r *restfulClient
+	// endpoint answers the attempt, it is replaced when a copy answers instead
+	endpoint string
+}
+
+func endpointAttemptFrom(ctx context.Context) *endpointAttempt {
+	attempt, _ := ctx.Value(endpointAttemptKey{}).(*endpointAttempt)
+	return attempt
+}
+
+// pick returns a copy of req sent to another endpoint picked by the balancer, when there is one
+func (a *endpointAttempt) pick(req *http.Request) (*http.Request, string) {
+	return a.r.pickEndpoint(req, []string{a.endpoint})
+}
+
+// done reports the result of a copy of the attempt to the balancer
+func (a *endpointAttempt) done(endpoint string, resp *http.Response, err error) {
+	a.r.balancer().Done(endpoint, resp, err)
+}
+
+// balancedBody reports the attempt to the balancer once it is closed, so that a streamed
+// response stays in flight until it is read
+type balancedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func(error)
+	err  error
+}
+
+func (b *balancedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *balancedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.done(b.err)
+	})
+	return err
+}
+
+// isConnectionError reports whether err means the endpoint could not be reached or dropped the connection
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b := NewBalancer(RoundRobin)
+	endpoints := []string{"a", "b", "c"}
+	var got []string
+	for i := 0; i < 4; i++ {
+		endpoint := b.Pick(endpoints, nil)
+		b.Done(endpoint, nil, nil)
+		got = append(got, endpoint)
+	}
+	if want := []string{"a", "b", "c", "a"}; !equalStrings(got, want) {
+		t.Errorf("picked %v, want %v", got, want)
+	}
+	if got := b.Pick(endpoints, []string{"a", "b"}); got != "c" {
+		t.Errorf("picked %s after a and b, want c", got)
+	}
+}
+
+func TestBalancerWeighted(t *testing.T) {
+	b := NewBalancer(WeightedRoundRobin, WithWeights(map[string]int{"a": 2}))
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		endpoint := b.Pick([]string{"a", "b"}, nil)
+		b.Done(endpoint, nil, nil)
+		counts[endpoint]++
+	}
+	if counts["a"] != 4 || counts["b"] != 2 {
+		t.Errorf("picked %v", counts)
+	}
+}
+
+func TestBalancerUnhealthy(t *testing.T) {
+	b := NewBalancer(RoundRobin).(*balancer)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.Done(b.Pick([]string{"a", "b"}, nil), nil, &net.OpError{Op: "dial", Err: errors.New("refused")})
+	for i := 0; i < 3; i++ {
+		if got := b.Pick([]string{"a", "b"}, nil); got != "b" {
+			t.Fatalf("picked %s, want b while a is unhealthy", got)
+		}
+		b.Done("b", nil, nil)
+	}
+	now = now.Add(b.unhealthyTimeout)
+	if got := b.Pick([]string{"a", "b"}, nil); got != "a" {
+		t.Errorf("picked %s, want a once healthy", got)
+	}
+}
+
+func TestBalancerInFlightUntilBodyClosed(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-release
+	})
+	a, b := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer a.Close()
+	defer b.Close()
+	defer close(release)
+
+	lb := NewBalancer(LeastInFlight).(*balancer)
+	client := ConfigureTransport(DefaultTransport, WithBalancer(lb)).Method(http.MethodGet).
+		Endpoints(a.URL, b.URL)
+	inFlight := func(endpoint string) int {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		return lb.state(endpoint).inFlight
+	}
+
+	// the headers are received while the body streams
+	first, err := client.(*restfulClient).send(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	streaming := a.URL
+	if inFlight(a.URL) == 0 {
+		streaming = b.URL
+	}
+	if inFlight(streaming) != 1 {
+		t.Fatalf("in flight %d while the body streams, want 1", inFlight(streaming))
+	}
+	second, err := client.(*restfulClient).send(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Request.URL.Host == first.Request.URL.Host {
+		t.Errorf("both requests sent to %s", first.Request.URL.Host)
+	}
+	first.Body.Close()
+	first.Body.Close()
+	if got := inFlight(streaming); got != 0 {
+		t.Errorf("in flight %d after the body is closed, want 0", got)
+	}
+	second.Body.Close()
+}
+
+func TestBalancedBodyReadError(t *testing.T) {
+	var got error
+	body := &balancedBody{
+		ReadCloser: io.NopCloser(errReader{io.ErrUnexpectedEOF}),
+		done:       func(err error) { got = err },
+	}
+	_, _ = io.ReadAll(body)
+	body.Close()
+	if !errors.Is(got, io.ErrUnexpectedEOF) {
+		t.Errorf("done with %v, want ErrUnexpectedEOF", got)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
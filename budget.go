@@ -0,0 +1,214 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExceeded is returned instead of retrying when the retry budget is spent
+var ErrRetryBudgetExceeded = errors.New("retry budget exceeded")
+
+// RetryBudgetError is returned instead of retrying when the retry budget is spent,
+// it matches ErrRetryBudgetExceeded and wraps the error of the last attempt
+type RetryBudgetError struct {
+	Err error
+}
+
+func (e *RetryBudgetError) Error() string {
+	if e.Err == nil {
+		return ErrRetryBudgetExceeded.Error()
+	}
+	return ErrRetryBudgetExceeded.Error() + "," + e.Err.Error()
+}
+
+func (e *RetryBudgetError) Is(target error) bool {
+	return target == ErrRetryBudgetExceeded
+}
+
+func (e *RetryBudgetError) Unwrap() error {
+	return e.Err
+}
+
+// ErrBulkheadFull is returned without sending the request when too many requests are in flight
+var ErrBulkheadFull = errors.New("too many requests in flight")
+
+const retryBudgetBuckets = 10
+
+// RetryBudget allows the retries of the requests sent through a Transport as long as they are
+// fewer than a ratio of the successful requests within a sliding window
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	window     time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets [retryBudgetBuckets]retryBudgetBucket
+}
+
+type retryBudgetBucket struct {
+	start     time.Time
+	successes int
+	retries   int
+}
+
+// NewRetryBudget returns a RetryBudget allowing minRetries plus ratio retries per successful request
+// within window, e.g. NewRetryBudget(0.1, 10, 10*time.Second) allows 10 retries plus 1 every 10 successes
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	return &RetryBudget{ratio: ratio, minRetries: minRetries, window: window, now: time.Now}
+}
+
+// Success records a successful request
+func (b *RetryBudget) Success() {
+	b.mu.Lock()
+	b.bucket().successes++
+	b.mu.Unlock()
+}
+
+// Withdraw reports whether a retry is allowed and records it if so
+func (b *RetryBudget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := b.bucket()
+	var successes, retries int
+	for _, bucket := range b.buckets {
+		if b.inWindow(bucket) {
+			successes += bucket.successes
+			retries += bucket.retries
+		}
+	}
+	if float64(retries) >= float64(b.minRetries)+b.ratio*float64(successes) {
+		return false
+	}
+	current.retries++
+	return true
+}
+
+// bucket returns the bucket of now, reset if it belonged to a previous window
+func (b *RetryBudget) bucket() *retryBudgetBucket {
+	width := b.window / retryBudgetBuckets
+	if width <= 0 {
+		width = 1
+	}
+	now := b.now()
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%retryBudgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = retryBudgetBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *RetryBudget) inWindow(bucket retryBudgetBucket) bool {
+	return !bucket.start.IsZero() && b.now().Sub(bucket.start) < b.window
+}
+
+// BulkheadOption configures the bulkhead created by NewBulkhead
+type BulkheadOption func(*Bulkhead)
+
+// WithBulkheadQueue lets up to size requests wait for a free slot until their context is done,
+// the requests are rejected at once by default
+func WithBulkheadQueue(size int) BulkheadOption {
+	return func(b *Bulkhead) {
+		b.queueSize = size
+	}
+}
+
+// WithBulkheadKey sets the function selecting the compartment of a request, per host by default
+func WithBulkheadKey(key func(*http.Request) string) BulkheadOption {
+	return func(b *Bulkhead) {
+		b.key = key
+	}
+}
+
+// Bulkhead limits the requests in flight through a Transport per host, a request is
+// in flight until its response body is closed
+type Bulkhead struct {
+	maxInFlight int
+	queueSize   int
+	key         func(*http.Request) string
+
+	mu           sync.Mutex
+	compartments map[string]*compartment
+}
+
+type compartment struct {
+	slots  chan struct{}
+	queued int
+}
+
+// NewBulkhead returns a Bulkhead letting maxInFlight requests in flight per compartment,
+// maxInFlight <= 0 means no limit
+func NewBulkhead(maxInFlight int, opts ...BulkheadOption) *Bulkhead {
+	b := &Bulkhead{
+		maxInFlight:  maxInFlight,
+		key:          func(req *http.Request) string { return req.URL.Host },
+		compartments: make(map[string]*compartment),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Acquire takes a slot for req, release must be called once the request is done
+func (b *Bulkhead) Acquire(req *http.Request) (release func(), err error) {
+	if b.maxInFlight <= 0 {
+		return func() {}, nil
+	}
+	b.mu.Lock()
+	key := b.key(req)
+	c, ok := b.compartments[key]
+	if !ok {
+		c = &compartment{slots: make(chan struct{}, b.maxInFlight)}
+		b.compartments[key] = c
+	}
+	select {
+	case c.slots <- struct{}{}:
+		b.mu.Unlock()
+		return c.release(), nil
+	default:
+	}
+	if c.queued >= b.queueSize {
+		b.mu.Unlock()
+		return nil, ErrBulkheadFull
+	}
+	c.queued++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		c.queued--
+		b.mu.Unlock()
+	}()
+	select {
+	case c.slots <- struct{}{}:
+		return c.release(), nil
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+func (c *compartment) release() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-c.slots
+		})
+	}
+}
+
+// releaseBody calls release once the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
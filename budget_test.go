@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+func TestRetryBudgetWindow(t *testing.T) {
+	now := time.Now()
+	budget := NewRetryBudget(0.5, 1, 10*time.Second)
+	budget.now = func() time.Time { return now }
+	if !budget.Withdraw() {
+		t.Fatal("the minimum retry should be allowed")
+	}
+	if budget.Withdraw() {
+		t.Fatal("a retry allowed beyond the budget")
+	}
+	budget.Success()
+	budget.Success()
+	if !budget.Withdraw() {
+		t.Fatal("the retry earned by 2 successes should be allowed")
+	}
+	now = now.Add(10 * time.Second)
+	if !budget.Withdraw() {
+		t.Fatal("the retries should be allowed again in a new window")
+	}
+}
+
+func TestRetryBudgetError(t *testing.T) {
+	errBoom := errors.New("boom")
+	var calls int32
+	transport := ConfigureTransport(DefaultTransport.WithClient(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errBoom
+	})), WithRetryBudget(NewRetryBudget(0, 1, time.Minute)))
+	err := transport.Method(http.MethodGet).Endpoints("http://localhost:80").
+		Retry(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 5), func(_ *http.Response, err error) bool {
+			return err != nil
+		}).
+		DoNop(context.Background())
+	if !errors.Is(err, ErrRetryBudgetExceeded) {
+		t.Errorf("error %v, want ErrRetryBudgetExceeded", err)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Errorf("error %v, want the cause", err)
+	}
+	var budgetErr *RetryBudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Errorf("error %T, want *RetryBudgetError", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("%d calls, want 2", got)
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:80/books", nil)
+	tests := []struct {
+		name        string
+		maxInFlight int
+		opts        []BulkheadOption
+		acquired    int
+	}{
+		{name: "limited", maxInFlight: 2, acquired: 2},
+		{name: "zero is unlimited", maxInFlight: 0, acquired: 10},
+		{name: "negative is unlimited", maxInFlight: -1, acquired: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bulkhead := NewBulkhead(tt.maxInFlight, tt.opts...)
+			var releases []func()
+			for i := 0; i < 10; i++ {
+				release, err := bulkhead.Acquire(req)
+				if err != nil {
+					if !errors.Is(err, ErrBulkheadFull) {
+						t.Fatalf("error %v, want ErrBulkheadFull", err)
+					}
+					break
+				}
+				releases = append(releases, release)
+			}
+			if len(releases) != tt.acquired {
+				t.Fatalf("acquired %d, want %d", len(releases), tt.acquired)
+			}
+			for _, release := range releases {
+				release()
+				release()
+			}
+			if _, err := bulkhead.Acquire(req); err != nil {
+				t.Errorf("acquire after release: %v", err)
+			}
+		})
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:80/books", nil)
+	bulkhead := NewBulkhead(1, WithBulkheadQueue(1))
+	release, err := bulkhead.Acquire(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() {
+		queuedRelease, err := bulkhead.Acquire(req)
+		if err == nil {
+			queuedRelease()
+		}
+		acquired <- err
+	}()
+	waitFor(t, func() bool {
+		bulkhead.mu.Lock()
+		defer bulkhead.mu.Unlock()
+		return bulkhead.compartments["localhost:80"].queued == 1
+	})
+	if _, err := bulkhead.Acquire(req); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("error %v with a full queue, want ErrBulkheadFull", err)
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("queued acquire: %v", err)
+	}
+
+	release, _ = bulkhead.Acquire(req)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := bulkhead.Acquire(req.WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,446 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheStatus tells how the response was served by the cache of NewCacheRoundTripper
+type CacheStatus string
+
+const (
+	// CacheMiss means the response was not in the cache or was stale without validators
+	CacheMiss CacheStatus = "MISS"
+	// CacheHit means the response was served from the cache
+	CacheHit CacheStatus = "HIT"
+	// CacheRevalidated means the cached response was served after the server answered 304
+	CacheRevalidated CacheStatus = "REVALIDATED"
+)
+
+const (
+	cacheRequestTime  = "X-Rest-Request-Time"
+	cacheResponseTime = "X-Rest-Response-Time"
+	cacheVaryPrefix   = "X-Rest-Vary-"
+)
+
+// NewCacheRoundTripper returns a private HTTP cache of RFC 7234 in front of roundTripper,
+// which caches the responses of GET requests into storage and revalidates them with
+// their ETag and Last-Modified, use it with Transport.WithClient.
+// The credential headers Authorization, Proxy-Authorization and Cookie are part of the key,
+// so that a response is only served to the requests of the same user, and an unsafe method
+// invalidates the responses cached for its credentials. e.g.
+//
+//	transport := rest.DefaultTransport.WithClient(
+//		rest.NewCacheRoundTripper(http.DefaultTransport, rest.NewMemoryCache(64<<20)))
+func NewCacheRoundTripper(roundTripper http.RoundTripper, storage CacheStorage) http.RoundTripper {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	return &cacheRoundTripper{next: roundTripper, storage: storage, now: time.Now}
+}
+
+type cacheRoundTripper struct {
+	next    http.RoundTripper
+	storage CacheStorage
+	now     func() time.Time
+}
+
+func (c *cacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		resp, err := c.next.RoundTrip(req)
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions &&
+			resp.StatusCode < http.StatusBadRequest {
+			// an unsafe method invalidates the cached responses of the resource
+			c.invalidate(req, resp)
+		}
+		return resp, err
+	}
+	if req.Header.Get("Range") != "" || req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" {
+		// the conditions of the caller are left to the server
+		return c.next.RoundTrip(req)
+	}
+	key := cacheKey(req.URL, req.Header)
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-cache"]; !ok && len(req.Header.Values("Cache-Control")) == 0 &&
+		strings.Contains(req.Header.Get("Pragma"), "no-cache") {
+		reqCC["no-cache"] = ""
+	}
+
+	var cached *cacheEntry
+	if _, noStore := reqCC["no-store"]; !noStore {
+		cached = c.load(key, req)
+	}
+	if cached != nil && cached.fresh(reqCC, c.now()) {
+		setCacheStatus(req, CacheHit)
+		return cached.response(req), nil
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		setCacheStatus(req, CacheMiss)
+		return &http.Response{
+			Status:     strconv.Itoa(http.StatusGatewayTimeout) + " " + http.StatusText(http.StatusGatewayTimeout),
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	outReq := req
+	if cached != nil {
+		etag, lastModified := cached.header.Get("ETag"), cached.header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outReq = req.Clone(req.Context())
+			if etag != "" {
+				outReq.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outReq.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	requestTime := c.now()
+	resp, err := c.next.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := c.now()
+
+	if outReq != req && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		for name, values := range resp.Header {
+			switch name {
+			case "Content-Length", "Transfer-Encoding", "Content-Encoding":
+				continue
+			}
+			cached.header[name] = values
+		}
+		cached.requestTime, cached.responseTime = requestTime, responseTime
+		c.store(key, cached)
+		setCacheStatus(req, CacheRevalidated)
+		return cached.response(req), nil
+	}
+	setCacheStatus(req, CacheMiss)
+	if !storable(reqCC, resp) {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	entry := &cacheEntry{
+		statusCode:   resp.StatusCode,
+		header:       resp.Header.Clone(),
+		body:         body,
+		vary:         make(http.Header),
+		requestTime:  requestTime,
+		responseTime: responseTime,
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		entry.vary[name] = req.Header.Values(name)
+	}
+	c.store(key, entry)
+	return resp, nil
+}
+
+func (c *cacheRoundTripper) load(key string, req *http.Request) *cacheEntry {
+	data, ok := c.storage.Get(key)
+	if !ok {
+		return nil
+	}
+	entry, err := unmarshalCacheEntry(data)
+	if err != nil {
+		c.storage.Delete(key)
+		return nil
+	}
+	// the selecting headers of the request must match those of the cached response
+	for name, values := range entry.vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return nil
+		}
+	}
+	return entry
+}
+
+func (c *cacheRoundTripper) store(key string, entry *cacheEntry) {
+	data, err := entry.marshal()
+	if err != nil {
+		return
+	}
+	c.storage.Set(key, data)
+}
+
+func (c *cacheRoundTripper) invalidate(req *http.Request, resp *http.Response) {
+	u := req.URL
+	c.storage.Delete(cacheKey(u, req.Header))
+	for _, name := range []string{"Location", "Content-Location"} {
+		location, err := u.Parse(resp.Header.Get(name))
+		if err != nil || resp.Header.Get(name) == "" || location.Host != u.Host {
+			continue
+		}
+		c.storage.Delete(cacheKey(location, req.Header))
+	}
+}
+
+func setCacheStatus(req *http.Request, status CacheStatus) {
+	if md := MetadataFrom(req.Context()); md != nil {
+		md.Cache = status
+	}
+}
+
+// cacheCredentials are the request headers keying the cached responses besides the URL
+var cacheCredentials = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// cacheKey returns the key of the URL and the hash of the credentials of header, if any
+func cacheKey(u *url.URL, header http.Header) string {
+	c := *u
+	c.Fragment, c.RawFragment = "", ""
+	key := c.String()
+	h := sha256.New()
+	credentials := false
+	for _, name := range cacheCredentials {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		credentials = true
+		fmt.Fprintf(h, "%s: %q\n", name, values)
+	}
+	if credentials {
+		key += " " + hex.EncodeToString(h.Sum(nil))
+	}
+	return key
+}
+
+// storable reports whether the response may be stored and used later
+func storable(reqCC map[string]string, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusPermanentRedirect, http.StatusNotFound, http.StatusMethodNotAllowed,
+		http.StatusGone, http.StatusRequestURITooLong, http.StatusNotImplemented:
+	default:
+		return false
+	}
+	if _, ok := reqCC["no-store"]; ok {
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	// without freshness nor validators a stored response could never be used
+	_, maxAge := respCC["max-age"]
+	return maxAge || resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// parseCacheControl parses the directives of Cache-Control, the names are lower case
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// deltaSeconds parses the argument of a directive like max-age
+func deltaSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	arg, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+type cacheEntry struct {
+	statusCode   int
+	header       http.Header
+	body         []byte
+	vary         http.Header
+	requestTime  time.Time
+	responseTime time.Time
+}
+
+// fresh reports whether the entry can be served without revalidation at now
+func (e *cacheEntry) fresh(reqCC map[string]string, now time.Time) bool {
+	respCC := parseCacheControl(e.header)
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	lifetime := e.lifetime(respCC)
+	if maxAge, ok := deltaSeconds(reqCC, "max-age"); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	age := e.age(now)
+	if minFresh, ok := deltaSeconds(reqCC, "min-fresh"); ok {
+		age += minFresh
+	}
+	if age < lifetime {
+		return true
+	}
+	if _, ok := respCC["must-revalidate"]; ok {
+		return false
+	}
+	if arg, ok := reqCC["max-stale"]; ok {
+		if arg == "" {
+			return true
+		}
+		maxStale, _ := deltaSeconds(reqCC, "max-stale")
+		return age < lifetime+maxStale
+	}
+	return false
+}
+
+// lifetime returns the freshness lifetime, which is heuristic when there is no explicit expiration time
+func (e *cacheEntry) lifetime(respCC map[string]string) time.Duration {
+	if maxAge, ok := deltaSeconds(respCC, "max-age"); ok {
+		return maxAge
+	}
+	date := e.date()
+	if expires := e.header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// an invalid date means already expired
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && date.After(lastModified) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.header.Get("Date")); err == nil {
+		return date
+	}
+	return e.responseTime
+}
+
+// age returns the current age of the entry
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := e.responseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	correctedAge := e.responseTime.Sub(e.requestTime)
+	if seconds, err := strconv.ParseInt(e.header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		correctedAge += time.Duration(seconds) * time.Second
+	}
+	if apparentAge > correctedAge {
+		correctedAge = apparentAge
+	}
+	return correctedAge + now.Sub(e.responseTime)
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.statusCode) + " " + http.StatusText(e.statusCode),
+		StatusCode:    e.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// marshal encodes the entry as an HTTP response, the times and the selecting headers
+// are kept in internal headers
+func (e *cacheEntry) marshal() ([]byte, error) {
+	header := e.header.Clone()
+	header.Set(cacheRequestTime, e.requestTime.Format(time.RFC3339Nano))
+	header.Set(cacheResponseTime, e.responseTime.Format(time.RFC3339Nano))
+	for name, values := range e.vary {
+		header[cacheVaryPrefix+name] = append([]string{""}, values...)
+	}
+	resp := e.response(nil)
+	resp.Header = header
+	var buf bytes.Buffer
+	if err := resp.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalCacheEntry(data []byte) (*cacheEntry, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{
+		statusCode: resp.StatusCode,
+		header:     resp.Header,
+		body:       body,
+		vary:       make(http.Header),
+	}
+	if entry.requestTime, err = time.Parse(time.RFC3339Nano, resp.Header.Get(cacheRequestTime)); err != nil {
+		return nil, err
+	}
+	if entry.responseTime, err = time.Parse(time.RFC3339Nano, resp.Header.Get(cacheResponseTime)); err != nil {
+		return nil, err
+	}
+	resp.Header.Del(cacheRequestTime)
+	resp.Header.Del(cacheResponseTime)
+	for name, values := range resp.Header {
+		if strings.HasPrefix(name, cacheVaryPrefix) {
+			// the first value is a placeholder so that an absent header is kept
+			entry.vary[strings.TrimPrefix(name, cacheVaryPrefix)] = values[1:]
+			delete(resp.Header, name)
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,259 @@
+package rest
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStorage stores the responses cached by NewCacheRoundTripper, it is best effort:
+// an entry may be dropped at any time, so an implementation may ignore its storage errors
+type CacheStorage interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+	Delete(key string)
+}
+
+// NewMemoryCache returns a CacheStorage keeping at most maxBytes of entries in memory,
+// the least recently used entries are evicted first
+func NewMemoryCache(maxBytes int64) CacheStorage {
+	return &memoryCache{
+		maxBytes: maxBytes,
+		entries:  list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+type memoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// entries is ordered from the most recently used
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+func (m *memoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.index[key]
+	if !ok {
+		return nil, false
+	}
+	m.entries.MoveToFront(elem)
+	return elem.Value.(*memoryEntry).data, true
+}
+
+func (m *memoryCache) Set(key string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(key)
+	size := int64(len(key) + len(data))
+	if size > m.maxBytes {
+		return
+	}
+	m.index[key] = m.entries.PushFront(&memoryEntry{key: key, data: data})
+	m.size += size
+	for m.size > m.maxBytes {
+		m.remove(m.entries.Back().Value.(*memoryEntry).key)
+	}
+}
+
+func (m *memoryCache) Delete(key string) {
+	m.mu.Lock()
+	m.remove(key)
+	m.mu.Unlock()
+}
+
+func (m *memoryCache) remove(key string) {
+	elem, ok := m.index[key]
+	if !ok {
+		return
+	}
+	entry := m.entries.Remove(elem).(*memoryEntry)
+	delete(m.index, key)
+	m.size -= int64(len(entry.key) + len(entry.data))
+}
+
+// NewDiskCache returns a CacheStorage keeping an entry per file in dir and at most maxBytes
+// of entries, the least recently used entries are evicted first. The entries already in dir
+// are counted, ordered by their modification time. Only the files named by the sha256 of a key,
+// and its own temporary files, are ever touched, so dir may be shared with other files
+func NewDiskCache(dir string, maxBytes int64) CacheStorage {
+	return &diskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+type diskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu     sync.Mutex
+	loaded bool
+	size   int64
+	// entries is ordered from the most recently used, by file name
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+// diskCacheTempPrefix prefixes the files written before they are renamed to their entry
+const diskCacheTempPrefix = ".rest-cache-tmp-"
+
+// isDiskCacheName reports whether name is the name of an entry, the hex encoded sha256 of its key
+func isDiskCacheName(name string) bool {
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	for _, c := range name {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type diskEntry struct {
+	name string
+	size int64
+}
+
+func (d *diskCache) Get(key string) ([]byte, bool) {
+	name := d.name(key)
+	data, err := os.ReadFile(filepath.Join(d.dir, name))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.load()
+	if err != nil {
+		d.remove(name)
+		return nil, false
+	}
+	if elem, ok := d.index[name]; ok {
+		d.entries.MoveToFront(elem)
+		// keep the order for the next load of dir
+		now := time.Now()
+		_ = os.Chtimes(filepath.Join(d.dir, name), now, now)
+	}
+	return data, true
+}
+
+func (d *diskCache) Set(key string, data []byte) {
+	name := d.name(key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.load()
+	d.delete(name)
+	size := int64(len(data))
+	if size > d.maxBytes {
+		return
+	}
+	if err := os.MkdirAll(d.dir, 0o700); err != nil {
+		return
+	}
+	// write a temporary file first, so that a reader never sees a partial entry
+	f, err := os.CreateTemp(d.dir, diskCacheTempPrefix+"*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(d.dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return
+	}
+	d.index[name] = d.entries.PushFront(&diskEntry{name: name, size: size})
+	d.size += size
+	for d.size > d.maxBytes {
+		d.delete(d.entries.Back().Value.(*diskEntry).name)
+	}
+}
+
+func (d *diskCache) Delete(key string) {
+	d.mu.Lock()
+	d.load()
+	d.delete(d.name(key))
+	d.mu.Unlock()
+}
+
+// load indexes the entries left in dir by a previous run, the most recently modified first
+func (d *diskCache) load() {
+	if d.loaded {
+		return
+	}
+	d.loaded = true
+	dirEntries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+	type fileInfo struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]fileInfo, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), diskCacheTempPrefix) {
+			// left by an interrupted Set
+			_ = os.Remove(filepath.Join(d.dir, entry.Name()))
+			continue
+		}
+		if !isDiskCacheName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, fileInfo{name: entry.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, f := range files {
+		d.index[f.name] = d.entries.PushBack(&diskEntry{name: f.name, size: f.size})
+		d.size += f.size
+	}
+	for d.size > d.maxBytes && d.entries.Len() != 0 {
+		d.delete(d.entries.Back().Value.(*diskEntry).name)
+	}
+}
+
+func (d *diskCache) delete(name string) {
+	d.remove(name)
+	_ = os.Remove(filepath.Join(d.dir, name))
+}
+
+func (d *diskCache) remove(name string) {
+	elem, ok := d.index[name]
+	if !ok {
+		return
+	}
+	entry := d.entries.Remove(elem).(*diskEntry)
+	delete(d.index, name)
+	d.size -= entry.size
+}
+
+func (d *diskCache) name(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
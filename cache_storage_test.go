@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	// every entry takes 1 byte of key and 4 bytes of data
+	cache := NewMemoryCache(10)
+	cache.Set("a", []byte("aaaa"))
+	cache.Set("b", []byte("bbbb"))
+	cache.Get("a")
+	cache.Set("c", []byte("cccc"))
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b should be evicted as the least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	cache.Set("d", []byte(strings.Repeat("d", 10)))
+	if _, ok := cache.Get("d"); ok {
+		t.Error("an entry larger than the cache should not be stored")
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewDiskCache(dir, 10)
+	cache.Set("a", []byte("aaaa"))
+	cache.Set("b", []byte("bbbb"))
+	if data, ok := cache.Get("a"); !ok || string(data) != "aaaa" {
+		t.Fatalf("a %q, %v", data, ok)
+	}
+	cache.Set("c", []byte("cccc"))
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b should be evicted as the least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	cache.Set("d", []byte(strings.Repeat("d", 11)))
+	if _, ok := cache.Get("d"); ok {
+		t.Error("an entry larger than the cache should not be stored")
+	}
+	cache.Set("a", []byte("aaaaaa"))
+	cache.Delete("c")
+	if files := diskCacheFiles(t, dir); files != 1 {
+		t.Errorf("%d files, want 1", files)
+	}
+}
+
+func TestDiskCacheLoad(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewDiskCache(dir, 100)
+	cache.Set("a", []byte("aaaa"))
+	cache.Set("b", []byte("bbbb"))
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, cache.(*diskCache).name("a")), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, diskCacheTempPrefix+"1"), []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a smaller cache on the same dir counts the existing entries
+	cache = NewDiskCache(dir, 6)
+	if _, ok := cache.Get("b"); !ok {
+		t.Error("b should be kept as the most recently used")
+	}
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a should be evicted to fit the size")
+	}
+	if files := diskCacheFiles(t, dir); files != 1 {
+		t.Errorf("%d files, want 1", files)
+	}
+}
+
+func TestDiskCacheSharedDir(t *testing.T) {
+	dir := t.TempDir()
+	foreign := map[string]string{
+		"tmp-1":                            "not a temporary file of the cache",
+		"notes.txt":                        "unrelated data",
+		"ABCDEF" + strings.Repeat("0", 58): "upper case hex is not a key",
+	}
+	for name, data := range foreign {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := NewDiskCache(dir, 8)
+	cache.Set("a", []byte("aaaa"))
+	cache.Set("b", []byte("bbbb"))
+	cache.Set("c", []byte("cccc"))
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a should be evicted to fit the size")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s should be kept, the other files are not counted", key)
+		}
+	}
+	for name, data := range foreign {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != data {
+			t.Errorf("%s was changed: %q, %v", name, got, err)
+		}
+	}
+	if files := diskCacheFiles(t, dir); files != len(foreign)+2 {
+		t.Errorf("%d files, want %d", files, len(foreign)+2)
+	}
+}
+
+func diskCacheFiles(t *testing.T, dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
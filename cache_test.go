@@ -0,0 +1,251 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cacheOrigin answers the requests by respond and records them
+type cacheOrigin struct {
+	requests []*http.Request
+	respond  func(req *http.Request) (int, http.Header)
+}
+
+func (o *cacheOrigin) RoundTrip(req *http.Request) (*http.Response, error) {
+	o.requests = append(o.requests, req)
+	statusCode, header := o.respond(req)
+	body := "v" + strconv.Itoa(len(o.requests))
+	if statusCode == http.StatusNotModified {
+		body = ""
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func newTestCache(origin *cacheOrigin, now *time.Time) http.RoundTripper {
+	c := NewCacheRoundTripper(origin, NewMemoryCache(1<<20)).(*cacheRoundTripper)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+// cacheGet sends a GET request of url with the headers given as name, value pairs
+func cacheGet(t *testing.T, rt http.RoundTripper, url string, headers ...string) (string, CacheStatus) {
+	t.Helper()
+	return cacheDo(t, rt, http.MethodGet, url, headers...)
+}
+
+func cacheDo(t *testing.T, rt http.RoundTripper, method, url string, headers ...string) (string, CacheStatus) {
+	t.Helper()
+	var md Metadata
+	req, err := http.NewRequestWithContext(WithMetadata(context.Background(), &md), method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(headers); i += 2 {
+		req.Header.Add(headers[i], headers[i+1])
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), md.Cache
+}
+
+func TestCacheFreshness(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	origin := &cacheOrigin{respond: func(req *http.Request) (int, http.Header) {
+		header := http.Header{"Cache-Control": {"max-age=60"}, "Date": {now.Format(http.TimeFormat)}}
+		return http.StatusOK, header
+	}}
+	rt := newTestCache(origin, &now)
+	const url = "http://example.com/books"
+	if body, status := cacheGet(t, rt, url); body != "v1" || status != CacheMiss {
+		t.Errorf("got %s %s, want v1 MISS", body, status)
+	}
+	now = now.Add(59 * time.Second)
+	if body, status := cacheGet(t, rt, url); body != "v1" || status != CacheHit {
+		t.Errorf("got %s %s, want v1 HIT", body, status)
+	}
+	if body, status := cacheGet(t, rt, url, "Cache-Control", "max-age=10"); body != "v2" || status != CacheMiss {
+		t.Errorf("got %s %s with max-age=10, want v2 MISS", body, status)
+	}
+	now = now.Add(61 * time.Second)
+	if body, status := cacheGet(t, rt, url); body != "v3" || status != CacheMiss {
+		t.Errorf("got %s %s when stale, want v3 MISS", body, status)
+	}
+	if len(origin.requests) != 3 {
+		t.Errorf("%d requests to the origin, want 3", len(origin.requests))
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	origin := &cacheOrigin{respond: func(req *http.Request) (int, http.Header) {
+		header := http.Header{"Cache-Control": {"no-cache"}, "X-Version": {"1"}}
+		header.Set("ETag", `"1"`)
+		if req.Header.Get("If-None-Match") == `"1"` {
+			header.Set("X-Version", "2")
+			return http.StatusNotModified, header
+		}
+		return http.StatusOK, header
+	}}
+	rt := newTestCache(origin, &now)
+	const url = "http://example.com/books/1"
+	if body, status := cacheGet(t, rt, url); body != "v1" || status != CacheMiss {
+		t.Errorf("got %s %s, want v1 MISS", body, status)
+	}
+	if body, status := cacheGet(t, rt, url); body != "v1" || status != CacheRevalidated {
+		t.Errorf("got %s %s, want v1 REVALIDATED", body, status)
+	}
+	if got := origin.requests[1].Header.Get("If-None-Match"); got != `"1"` {
+		t.Errorf("If-None-Match %s, want \"1\"", got)
+	}
+	// the headers of the 304 response update the cached response
+	data, ok := rt.(*cacheRoundTripper).storage.Get(cacheKey(origin.requests[0].URL, nil))
+	if !ok {
+		t.Fatal("the revalidated response should be stored")
+	}
+	entry, err := unmarshalCacheEntry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entry.header.Get("X-Version"); got != "2" {
+		t.Errorf("X-Version %s, want 2", got)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	origin := &cacheOrigin{respond: func(req *http.Request) (int, http.Header) {
+		return http.StatusOK, http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}}
+	}}
+	rt := newTestCache(origin, &now)
+	const url = "http://example.com/books"
+	tests := []struct {
+		language string
+		want     string
+		status   CacheStatus
+	}{
+		{language: "en", want: "v1", status: CacheMiss},
+		{language: "en", want: "v1", status: CacheHit},
+		{language: "fr", want: "v2", status: CacheMiss},
+		{language: "fr", want: "v2", status: CacheHit},
+	}
+	for _, tt := range tests {
+		if body, status := cacheGet(t, rt, url, "Accept-Language", tt.language); body != tt.want || status != tt.status {
+			t.Errorf("%s: got %s %s, want %s %s", tt.language, body, status, tt.want, tt.status)
+		}
+	}
+}
+
+func TestCacheNoStore(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	tests := []struct {
+		name     string
+		response string
+		request  []string
+	}{
+		{name: "response", response: "no-store, max-age=60"},
+		{name: "request", response: "max-age=60", request: []string{"Cache-Control", "no-store"}},
+		{name: "vary all", response: "max-age=60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := &cacheOrigin{respond: func(req *http.Request) (int, http.Header) {
+				header := http.Header{"Cache-Control": {tt.response}}
+				if tt.name == "vary all" {
+					header.Set("Vary", "*")
+				}
+				return http.StatusOK, header
+			}}
+			rt := newTestCache(origin, &now)
+			for i := 1; i <= 2; i++ {
+				body, status := cacheGet(t, rt, "http://example.com/books", tt.request...)
+				if want := "v" + strconv.Itoa(i); body != want || status != CacheMiss {
+					t.Errorf("got %s %s, want %s MISS", body, status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	origin := &cacheOrigin{respond: func(req *http.Request) (int, http.Header) {
+		switch req.Method {
+		case http.MethodPost:
+			return http.StatusCreated, http.Header{"Location": {"/books/2"}}
+		case http.MethodDelete:
+			return http.StatusNotFound, http.Header{}
+		}
+		return http.StatusOK, http.Header{"Cache-Control": {"max-age=60"}}
+	}}
+	rt := newTestCache(origin, &now)
+	const books, book = "http://example.com/books", "http://example.com/books/2"
+	cacheGet(t, rt, books)
+	cacheGet(t, rt, book)
+	// a failed unsafe request doesn't invalidate
+	cacheDo(t, rt, http.MethodDelete, books)
+	for _, url := range []string{books, book} {
+		if _, status := cacheGet(t, rt, url); status != CacheHit {
+			t.Errorf("%s: %s after a failed DELETE, want HIT", url, status)
+		}
+	}
+	// neither the request URL nor the Location can be served anymore
+	cacheDo(t, rt, http.MethodPost, books)
+	for _, url := range []string{books, book} {
+		if _, status := cacheGet(t, rt, url); status != CacheMiss {
+			t.Errorf("%s: %s after POST, want MISS", url, status)
+		}
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	origin := &cacheOrigin{respond: func(req *http.Request) (int, http.Header) {
+		return http.StatusOK, http.Header{"Cache-Control": {"private, max-age=60"}}
+	}}
+	rt := newTestCache(origin, &now)
+	const url = "http://example.com/me"
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+		status  CacheStatus
+	}{
+		{name: "alice", headers: []string{"Authorization", "Bearer alice"}, want: "v1", status: CacheMiss},
+		{name: "bob", headers: []string{"Authorization", "Bearer bob"}, want: "v2", status: CacheMiss},
+		{name: "anonymous", want: "v3", status: CacheMiss},
+		{name: "cookie", headers: []string{"Cookie", "session=alice"}, want: "v4", status: CacheMiss},
+		{name: "alice again", headers: []string{"Authorization", "Bearer alice"}, want: "v1", status: CacheHit},
+		{name: "bob again", headers: []string{"Authorization", "Bearer bob"}, want: "v2", status: CacheHit},
+		{name: "anonymous again", want: "v3", status: CacheHit},
+	}
+	for _, tt := range tests {
+		if body, status := cacheGet(t, rt, url, tt.headers...); body != tt.want || status != tt.status {
+			t.Errorf("%s: got %s %s, want %s %s", tt.name, body, status, tt.want, tt.status)
+		}
+	}
+	// the cached responses of other users are kept
+	cacheDo(t, rt, http.MethodPut, url, "Authorization", "Bearer alice")
+	if _, status := cacheGet(t, rt, url, "Authorization", "Bearer alice"); status != CacheMiss {
+		t.Errorf("alice: %s after PUT, want MISS", status)
+	}
+	if _, status := cacheGet(t, rt, url, "Authorization", "Bearer bob"); status != CacheHit {
+		t.Errorf("bob: %s after the PUT of alice, want HIT", status)
+	}
+}
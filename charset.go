@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CharsetReader returns a reader that transcodes r to UTF-8 according to the charset
+// parameter of contentType, such as GBK, GB18030, Shift_JIS or ISO-8859-1.
+// A leading byte order mark takes precedence over the declared charset and is stripped,
+// when no charset is declared the content is treated as UTF-8.
+func CharsetReader(r io.Reader, contentType string) (io.Reader, error) {
+	var label string
+	if contentType != "" {
+		_, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, err
+		}
+		label = params["charset"]
+	}
+	enc, err := lookupCharset(label)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewReader(r, unicode.BOMOverride(enc.NewDecoder())), nil
+}
+
+func lookupCharset(label string) (encoding.Encoding, error) {
+	label = strings.Trim(strings.TrimSpace(label), `"'`)
+	if label == "" {
+		return unicode.UTF8, nil
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return enc, nil
+}
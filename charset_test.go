@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stubResponse returns a client whose requests are answered with body and contentType
+func stubResponse(contentType string, body []byte) RESTClient {
+	return DefaultTransport.WithClient(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header := make(http.Header)
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	})).Method(http.MethodGet).Endpoints("http://localhost:80")
+}
+
+func TestDoStringCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        string
+		wantErr     bool
+	}{
+		{name: "utf-8 passthrough", contentType: "text/plain; charset=utf-8", body: []byte("héllo, 世界"), want: "héllo, 世界"},
+		{name: "no charset", contentType: "text/plain", body: []byte("héllo"), want: "héllo"},
+		{name: "no content type", body: []byte("héllo"), want: "héllo"},
+		{name: "gbk", contentType: "text/plain; charset=GBK", body: []byte{0xd6, 0xd0, 0xce, 0xc4}, want: "中文"},
+		{name: "gb18030", contentType: "text/plain; charset=gb18030", body: []byte{0xd6, 0xd0, 0xce, 0xc4}, want: "中文"},
+		{name: "shift_jis", contentType: `text/plain; charset="Shift_JIS"`, body: []byte{0x93, 0xfa, 0x96, 0x7b}, want: "日本"},
+		{name: "latin-1", contentType: "text/html; charset=ISO-8859-1", body: []byte{'c', 'a', 'f', 0xe9}, want: "café"},
+		{name: "utf-8 bom without charset", contentType: "text/plain", body: []byte("\xef\xbb\xbfok"), want: "ok"},
+		{name: "utf-16le bom without charset", body: []byte{0xff, 0xfe, 'h', 0, 'i', 0}, want: "hi"},
+		{name: "bom over the declared charset", contentType: "text/plain; charset=GBK", body: []byte{0xfe, 0xff, 0, 'h', 0, 'i'}, want: "hi"},
+		{name: "unknown charset", contentType: "text/plain; charset=x-klingon", body: []byte("qapla'"), wantErr: true},
+		{name: "invalid content type", contentType: "text/plain; charset", body: []byte("a"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stubResponse(tt.contentType, tt.body).DoString(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCharsetReaderUnknown(t *testing.T) {
+	_, err := CharsetReader(strings.NewReader("a"), "text/plain; charset=x-klingon")
+	if err == nil || !strings.Contains(err.Error(), "x-klingon") {
+		t.Errorf("error %v, want the unsupported charset", err)
+	}
+}
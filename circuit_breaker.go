@@ -0,0 +1,238 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request when the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets the requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects the requests with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen lets a few requests through to probe whether the server is back
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerOption configures the circuit breaker of NewCircuitBreakerRoundTripper
+type CircuitBreakerOption func(*circuitBreaker)
+
+// WithCircuitKey sets the function selecting the circuit of a request, CircuitByHost by default
+func WithCircuitKey(key func(*http.Request) string) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.key = key
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failures opening the circuit, 5 by default
+func WithFailureThreshold(failures int) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.failureThreshold = failures
+	}
+}
+
+// WithOpenTimeout sets how long the circuit stays open before probing the server, 30s by default
+func WithOpenTimeout(timeout time.Duration) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.openTimeout = timeout
+	}
+}
+
+// WithHalfOpenRequests sets the number of successful probes closing the circuit, 1 by default
+func WithHalfOpenRequests(requests int) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.halfOpenRequests = requests
+	}
+}
+
+// WithFailureCondition sets the function telling whether a request failed, OnRetryCondition by default
+func WithFailureCondition(condition func(*http.Response, error) bool) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.failed = condition
+	}
+}
+
+// WithCircuitLogger sets the logger of the state changes
+func WithCircuitLogger(from func(context.Context) Logger) CircuitBreakerOption {
+	return func(b *circuitBreaker) {
+		b.from = from
+	}
+}
+
+// CircuitByHost keeps a circuit per host
+func CircuitByHost(req *http.Request) string {
+	return req.URL.Host
+}
+
+// SingleCircuit keeps a single circuit for all the requests, e.g. those of a Handler
+func SingleCircuit(*http.Request) string {
+	return ""
+}
+
+// NewCircuitBreakerRoundTripper returns a RoundTripper failing fast with ErrCircuitOpen once
+// the requests to roundTripper failed several times in a row, until a probe succeeds.
+// The requests canceled or timed out by their context count neither as failures nor as successes. e.g.
+//
+//	transport := rest.DefaultTransport.WithClient(
+//		rest.NewCircuitBreakerRoundTripper(http.DefaultTransport, rest.WithOpenTimeout(10*time.Second)))
+func NewCircuitBreakerRoundTripper(roundTripper http.RoundTripper, opts ...CircuitBreakerOption) http.RoundTripper {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	b := &circuitBreaker{
+		next:             roundTripper,
+		key:              CircuitByHost,
+		failureThreshold: 5,
+		openTimeout:      30 * time.Second,
+		halfOpenRequests: 1,
+		failed:           OnRetryCondition,
+		from:             Nop,
+		now:              time.Now,
+		circuits:         make(map[string]*circuit),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+type circuitBreaker struct {
+	next             http.RoundTripper
+	key              func(*http.Request) string
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+	failed           func(*http.Response, error) bool
+	from             func(context.Context) Logger
+	now              func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// probes in flight and successful probes of the half-open state
+	probes    int
+	successes int
+}
+
+func (b *circuitBreaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := b.key(req)
+	probe, err := b.allow(req.Context(), key)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	resp, err := b.next.RoundTrip(req)
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// the caller gave up, which tells nothing about the server
+		b.release(key, probe)
+		return resp, err
+	}
+	b.done(req.Context(), key, probe, b.failed(resp, err))
+	return resp, err
+}
+
+// release frees the probe of a request which is neither a success nor a failure
+func (b *circuitBreaker) release(key string, probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	b.circuits[key].probes--
+	b.mu.Unlock()
+}
+
+// allow tells whether a request may be sent, probe is set for the requests of the half-open state
+func (b *circuitBreaker) allow(ctx context.Context, key string) (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	if c.state == CircuitOpen && b.now().Sub(c.openedAt) >= b.openTimeout {
+		b.setState(ctx, key, c, CircuitHalfOpen)
+	}
+	switch c.state {
+	case CircuitOpen:
+		return false, fmt.Errorf("%s: %w", key, ErrCircuitOpen)
+	case CircuitHalfOpen:
+		if c.probes+c.successes >= b.halfOpenRequests {
+			return false, fmt.Errorf("%s: %w", key, ErrCircuitOpen)
+		}
+		c.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// done records the result of a request
+func (b *circuitBreaker) done(ctx context.Context, key string, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[key]
+	switch {
+	case probe:
+		c.probes--
+		if c.state != CircuitHalfOpen {
+			return
+		}
+		if failed {
+			b.setState(ctx, key, c, CircuitOpen)
+			return
+		}
+		if c.successes++; c.successes >= b.halfOpenRequests {
+			b.setState(ctx, key, c, CircuitClosed)
+		}
+	case c.state == CircuitClosed:
+		// the requests sent before the circuit opened are ignored
+		if !failed {
+			c.failures = 0
+			return
+		}
+		if c.failures++; c.failures >= b.failureThreshold {
+			b.setState(ctx, key, c, CircuitOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(ctx context.Context, key string, c *circuit, state CircuitState) {
+	from := c.state
+	c.state = state
+	c.failures, c.successes = 0, 0
+	logger := b.from(ctx)
+	switch state {
+	case CircuitOpen:
+		c.openedAt = b.now()
+		logger.Warnf("circuit breaker %q changed from %s to %s", key, from, state)
+	default:
+		logger.Infof("circuit breaker %q changed from %s to %s", key, from, state)
+	}
+}
@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// testCircuitBreaker returns a circuit breaker whose requests answer the status codes or errors
+// sent to the returned channel
+func testCircuitBreaker(now *time.Time, opts ...CircuitBreakerOption) (*circuitBreaker, chan interface{}) {
+	results := make(chan interface{}, 16)
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		switch result := (<-results).(type) {
+		case error:
+			return nil, result
+		case int:
+			return &http.Response{StatusCode: result, Header: make(http.Header), Body: http.NoBody, Request: req}, nil
+		}
+		panic("unexpected result")
+	})
+	b := NewCircuitBreakerRoundTripper(next, append([]CircuitBreakerOption{WithCircuitKey(SingleCircuit)}, opts...)...).(*circuitBreaker)
+	b.now = func() time.Time { return *now }
+	return b, results
+}
+
+func circuitSend(t *testing.T, b *circuitBreaker, results chan interface{}, result interface{}) error {
+	t.Helper()
+	if result != nil {
+		results <- result
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:80/books", nil)
+	_, err := b.RoundTrip(req)
+	return err
+}
+
+func circuitState(b *circuitBreaker) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuits[""].state
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	b, results := testCircuitBreaker(&now, WithFailureThreshold(2), WithOpenTimeout(10*time.Second))
+
+	// the failures must be consecutive
+	circuitSend(t, b, results, http.StatusBadGateway)
+	circuitSend(t, b, results, http.StatusOK)
+	circuitSend(t, b, results, http.StatusBadGateway)
+	if state := circuitState(b); state != CircuitClosed {
+		t.Fatalf("%s after a success between the failures, want closed", state)
+	}
+	circuitSend(t, b, results, http.StatusBadGateway)
+	if state := circuitState(b); state != CircuitOpen {
+		t.Fatalf("%s after 2 failures, want open", state)
+	}
+	if err := circuitSend(t, b, results, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error %v, want ErrCircuitOpen", err)
+	}
+
+	// a failed probe opens the circuit for another timeout
+	now = now.Add(10 * time.Second)
+	if err := circuitSend(t, b, results, http.StatusGatewayTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if state := circuitState(b); state != CircuitOpen {
+		t.Fatalf("%s after a failed probe, want open", state)
+	}
+	now = now.Add(9 * time.Second)
+	if err := circuitSend(t, b, results, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error %v, want ErrCircuitOpen", err)
+	}
+
+	// a successful probe closes it
+	now = now.Add(time.Second)
+	if err := circuitSend(t, b, results, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if state := circuitState(b); state != CircuitClosed {
+		t.Fatalf("%s after a successful probe, want closed", state)
+	}
+}
+
+func TestCircuitBreakerHalfOpenRequests(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	b, results := testCircuitBreaker(&now, WithFailureThreshold(1), WithHalfOpenRequests(2))
+	circuitSend(t, b, results, http.StatusBadGateway)
+	now = now.Add(30 * time.Second)
+
+	// two probes are in flight, the next request is rejected
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- circuitSend(t, b, results, nil)
+		}()
+	}
+	waitFor(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.circuits[""].probes == 2
+	})
+	if err := circuitSend(t, b, results, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error %v, want ErrCircuitOpen beyond the probes", err)
+	}
+	results <- http.StatusOK
+	waitFor(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.circuits[""].successes == 1
+	})
+	if state := circuitState(b); state != CircuitHalfOpen {
+		t.Fatalf("%s after 1 of 2 probes, want half-open", state)
+	}
+	results <- http.StatusOK
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state := circuitState(b); state != CircuitClosed {
+		t.Fatalf("%s after 2 probes, want closed", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresCanceled(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	b, results := testCircuitBreaker(&now, WithFailureThreshold(2))
+
+	// a canceled request doesn't reset the failures
+	circuitSend(t, b, results, http.StatusBadGateway)
+	circuitSend(t, b, results, context.Canceled)
+	circuitSend(t, b, results, http.StatusBadGateway)
+	if state := circuitState(b); state != CircuitOpen {
+		t.Fatalf("%s after 2 failures around a canceled request, want open", state)
+	}
+
+	// a canceled probe neither closes nor opens the circuit, and lets another probe through
+	now = now.Add(30 * time.Second)
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded} {
+		if got := circuitSend(t, b, results, err); !errors.Is(got, err) {
+			t.Fatalf("error %v, want %v", got, err)
+		}
+		if state := circuitState(b); state != CircuitHalfOpen {
+			t.Fatalf("%s after a probe failing with %v, want half-open", state, err)
+		}
+	}
+	if err := circuitSend(t, b, results, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if state := circuitState(b); state != CircuitClosed {
+		t.Fatalf("%s after a successful probe, want closed", state)
+	}
+}
+
+func TestCircuitBreakerFailover(t *testing.T) {
+	var failed, ok int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok++
+	}))
+	defer up.Close()
+
+	breaker := NewCircuitBreakerRoundTripper(http.DefaultTransport, WithFailureThreshold(1))
+	client := DefaultTransport.WithClient(breaker).Method(http.MethodGet).Endpoints(down.URL, up.URL).
+		Retry(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1), OnRetryCondition)
+	for i := 0; i < 4; i++ {
+		if err := client.DoNop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if failed != 1 || ok != 4 {
+		t.Errorf("%d requests to the failed endpoint, %d to the other, want 1 and 4", failed, ok)
+	}
+
+	// without another endpoint the error is returned at once
+	err := DefaultTransport.WithClient(breaker).Method(http.MethodGet).Endpoints(down.URL).
+		Retry(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3), OnRetryCondition).DoNop(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) || failed != 1 {
+		t.Errorf("error %v after %d requests, want ErrCircuitOpen", err, failed)
+	}
+}
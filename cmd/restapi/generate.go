@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func header(buf *bytes.Buffer, pkg string, imports map[string]string) {
+	buf.WriteString("// Code generated by restapi. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", pkg)
+	paths := make(map[string]string, len(imports))
+	for name, path := range imports {
+		paths[path] = name
+	}
+	var std, others []string
+	for path := range paths {
+		if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			others = append(others, path)
+			continue
+		}
+		std = append(std, path)
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	spec := func(path string) string {
+		if name := paths[path]; name != path[strings.LastIndexByte(path, '/')+1:] {
+			return name + " " + strconv.Quote(path)
+		}
+		return strconv.Quote(path)
+	}
+	buf.WriteString("import (\n")
+	for _, path := range std {
+		fmt.Fprintf(buf, "\t%s\n", spec(path))
+	}
+	buf.WriteString("\n")
+	for _, path := range others {
+		fmt.Fprintf(buf, "\t%s\n", spec(path))
+	}
+	buf.WriteString(")\n\n")
+}
+
+func unexported(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// signature returns the signature of m, the parameters are renamed by rename if it is not nil
+func signature(m *Method, rename func(int) string) string {
+	params := make([]string, len(m.Params))
+	for i, p := range m.Params {
+		name := p.Name
+		if rename != nil {
+			name = rename(i)
+		}
+		params[i] = name + " " + p.Type
+	}
+	result := "error"
+	if m.Result != "" {
+		result = "(" + m.Result + ", error)"
+	}
+	return fmt.Sprintf("%s(%s) %s", m.Name, strings.Join(params, ", "), result)
+}
+
+func stringExpr(p *Param, ident string) string {
+	if p.Type == "string" {
+		return ident
+	}
+	return "fmt.Sprint(" + ident + ")"
+}
+
+// identifiers returns the identifiers of the parameters of m in the generated method, the parameters
+// named like the receiver, a local variable or a package used by the method body are renamed
+func identifiers(m *Method, imports map[string]string) map[string]string {
+	reserved := map[string]bool{"c": true, "result": true, "err": true, "fmt": true}
+	for name := range imports {
+		reserved[name] = true
+	}
+	if m.Result != "" {
+		if expr, err := parser.ParseExpr(m.Result); err == nil {
+			ast.Inspect(expr, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					reserved[id.Name] = true
+				}
+				return true
+			})
+		}
+	}
+	names := make(map[string]bool, len(m.Params))
+	for _, p := range m.Params {
+		names[p.Name] = true
+	}
+	idents := make(map[string]string, len(m.Params))
+	for _, p := range m.Params {
+		ident := p.Name
+		for reserved[ident] || (ident != p.Name && names[ident]) {
+			ident += "_"
+		}
+		idents[p.Name] = ident
+	}
+	return idents
+}
+
+// GenerateClient generates the implementation of api on rest.Handler
+func GenerateClient(api *API) ([]byte, error) {
+	imports := map[string]string{"http": "net/http", "rest": "github.com/crochee/rest"}
+	for name, path := range api.Imports {
+		imports[name] = path
+	}
+	impl := unexported(api.Name)
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "// New%s returns a %s sending the requests through handler\n", api.Name, api.Name)
+	fmt.Fprintf(&body, "func New%s(handler rest.Handler) %s {\n\treturn &%s{handler: handler}\n}\n\n", api.Name, api.Name, impl)
+	fmt.Fprintf(&body, "type %s struct {\n\thandler rest.Handler\n}\n\n", impl)
+	for _, m := range api.Methods {
+		idents := identifiers(m, imports)
+		ctx := idents[m.Params[0].Name]
+		fmt.Fprintf(&body, "func (c *%s) %s {\n", impl, signature(m, func(i int) string { return idents[m.Params[i].Name] }))
+		var (
+			target = "nil"
+			deref  bool
+		)
+		if m.Result != "" {
+			// results are decoded into the value behind the pointer
+			typ := m.Result
+			if deref = strings.HasPrefix(typ, "*"); deref {
+				typ = typ[1:]
+			}
+			fmt.Fprintf(&body, "\tvar result %s\n", typ)
+			target = "&result"
+		}
+		fmt.Fprintf(&body, "\terr := c.handler.To().Method(http.Method%s).\n", m.Verb[:1]+strings.ToLower(m.Verb[1:]))
+		if names := placeholders(m.Path); len(names) != 0 {
+			fmt.Fprintf(&body, "\t\tPath(%q, map[string]string{\n", m.Path)
+			for _, name := range names {
+				for _, p := range m.Params {
+					if p.Name == name {
+						fmt.Fprintf(&body, "\t\t\t%q: %s,\n", name, stringExpr(p, idents[p.Name]))
+						if p.Type != "string" {
+							imports["fmt"] = "fmt"
+						}
+					}
+				}
+			}
+			body.WriteString("\t\t}).\n")
+		} else {
+			fmt.Fprintf(&body, "\t\tPath(%q, nil).\n", m.Path)
+		}
+		for _, q := range m.Queries {
+			if q.Key == "" {
+				fmt.Fprintf(&body, "\t\tQuerys(%s).\n", idents[q.Param.Name])
+				continue
+			}
+			if q.Param.Type != "string" {
+				imports["fmt"] = "fmt"
+			}
+			fmt.Fprintf(&body, "\t\tQuery(%q, %s).\n", q.Key, stringExpr(q.Param, idents[q.Param.Name]))
+		}
+		for _, h := range m.Headers {
+			if h.Param.Type != "string" {
+				imports["fmt"] = "fmt"
+			}
+			fmt.Fprintf(&body, "\t\tSetHeader(%q, %s).\n", h.Key, stringExpr(h.Param, idents[h.Param.Name]))
+		}
+		if m.Body != "" {
+			fmt.Fprintf(&body, "\t\tBody(%s).\n", idents[m.Body])
+		}
+		codes := make([]string, len(m.Status))
+		for i, code := range m.Status {
+			codes[i] = strconv.Itoa(code)
+		}
+		fmt.Fprintf(&body, "\t\tDo(%s, %s, rest.ErrorFunc(%s))\n", ctx, target, strings.Join(codes, ", "))
+		switch {
+		case m.Result == "":
+			body.WriteString("\treturn err\n")
+		case deref:
+			body.WriteString("\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn &result, nil\n")
+		default:
+			body.WriteString("\treturn result, err\n")
+		}
+		body.WriteString("}\n\n")
+	}
+	var buf bytes.Buffer
+	header(&buf, api.Package, imports)
+	buf.Write(body.Bytes())
+	return formatSource(buf.Bytes())
+}
+
+// GenerateMock generates a gomock compatible mock of api, like mockgen does
+func GenerateMock(api *API) ([]byte, error) {
+	imports := map[string]string{"reflect": "reflect", "gomock": "github.com/golang/mock/gomock"}
+	for name, path := range api.Imports {
+		imports[name] = path
+	}
+	mock := "Mock" + api.Name
+	recorder := mock + "MockRecorder"
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "// %s is a mock of %s interface.\n", mock, api.Name)
+	fmt.Fprintf(&body, "type %s struct {\n\tctrl     *gomock.Controller\n\trecorder *%s\n}\n\n", mock, recorder)
+	fmt.Fprintf(&body, "// %s is the mock recorder for %s.\n", recorder, mock)
+	fmt.Fprintf(&body, "type %s struct {\n\tmock *%s\n}\n\n", recorder, mock)
+	fmt.Fprintf(&body, "// New%s creates a new mock instance.\n", mock)
+	fmt.Fprintf(&body, "func New%s(ctrl *gomock.Controller) *%s {\n\tmock := &%s{ctrl: ctrl}\n\tmock.recorder = &%s{mock}\n\treturn mock\n}\n\n",
+		mock, mock, mock, recorder)
+	body.WriteString("// EXPECT returns an object that allows the caller to indicate expected use.\n")
+	fmt.Fprintf(&body, "func (m *%s) EXPECT() *%s {\n\treturn m.recorder\n}\n\n", mock, recorder)
+	// parameters are renamed like mockgen does, so that they don't shadow the receiver
+	arg := func(i int) string { return "arg" + strconv.Itoa(i) }
+	for _, m := range api.Methods {
+		args := make([]string, len(m.Params))
+		recorderParams := make([]string, len(m.Params))
+		for i := range m.Params {
+			args[i] = arg(i)
+			recorderParams[i] = arg(i) + " interface{}"
+		}
+		fmt.Fprintf(&body, "// %s mocks base method.\n", m.Name)
+		fmt.Fprintf(&body, "func (m *%s) %s {\n\tm.ctrl.T.Helper()\n", mock, signature(m, arg))
+		fmt.Fprintf(&body, "\tret := m.ctrl.Call(m, %q, %s)\n", m.Name, strings.Join(args, ", "))
+		if m.Result == "" {
+			body.WriteString("\tret0, _ := ret[0].(error)\n\treturn ret0\n}\n\n")
+		} else {
+			fmt.Fprintf(&body, "\tret0, _ := ret[0].(%s)\n\tret1, _ := ret[1].(error)\n\treturn ret0, ret1\n}\n\n", m.Result)
+		}
+		fmt.Fprintf(&body, "// %s indicates an expected call of %s.\n", m.Name, m.Name)
+		fmt.Fprintf(&body, "func (mr *%s) %s(%s) *gomock.Call {\n\tmr.mock.ctrl.T.Helper()\n", recorder, m.Name, strings.Join(recorderParams, ", "))
+		fmt.Fprintf(&body, "\treturn mr.mock.ctrl.RecordCallWithMethodType(mr.mock, %q, reflect.TypeOf((*%s)(nil).%s), %s)\n}\n\n",
+			m.Name, mock, m.Name, strings.Join(args, ", "))
+	}
+	var buf bytes.Buffer
+	header(&buf, api.Package, imports)
+	buf.Write(body.Bytes())
+	return formatSource(buf.Bytes())
+}
+
+func formatSource(src []byte) ([]byte, error) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, src)
+	}
+	return formatted, nil
+}
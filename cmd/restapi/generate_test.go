@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	api, err := ParseAPI(filepath.Join("testdata", "books"), "BookAPI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		generate func(*API) ([]byte, error)
+	}{
+		{name: "books_rest", generate: GenerateClient},
+		{name: "books_mock", generate: GenerateMock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.generate(api)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err = os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("generated code differs from %s, run go test -update to accept it:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestGenerateCompiles builds the generated client and mock with the package of the interface
+// in a module replacing github.com/crochee/rest by this repository
+func TestGenerateCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip(err)
+	}
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src, err := os.ReadFile(filepath.Join("testdata", "books", "books.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := "module example.com/books\n\ngo 1.18\n\nrequire github.com/crochee/rest v0.0.0\n\nreplace github.com/crochee/rest => " +
+		filepath.ToSlash(root) + "\n"
+	files := map[string][]byte{"go.mod": []byte(mod), "go.sum": sum, "books.go": src}
+	if err = run("BookAPI", filepath.Join("testdata", "books"), filepath.Join(dir, "bookapi_rest.go"),
+		filepath.Join(dir, "bookapi_mock.go")); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goBin, "vet", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
+
+func TestParseAPIErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		iface string
+		want  string
+	}{
+		{
+			name: "unbound parameter",
+			iface: `// @GET /v2/books/{id}
+	Get(ctx context.Context, id, version string) error`,
+			want: "parameter version is not bound",
+		},
+		{
+			name: "missing placeholder parameter",
+			iface: `// @GET /v2/books/{id}
+	Get(ctx context.Context) error`,
+			want: "no parameter for path placeholder {id}",
+		},
+		{
+			name:  "missing annotation",
+			iface: `Get(ctx context.Context) error`,
+			want:  "missing annotation",
+		},
+		{
+			name: "no context",
+			iface: `// @GET /v2/books
+	List(limit int) error`,
+			want: "the first parameter must be context.Context",
+		},
+		{
+			name: "no error",
+			iface: `// @GET /v2/books
+	List(ctx context.Context) int`,
+			want: "the last result must be error",
+		},
+		{
+			name: "unknown parameter",
+			iface: `// @GET /v2/books
+	// @Query limit
+	List(ctx context.Context) error`,
+			want: "@Query: unknown parameter limit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package books\n\nimport \"context\"\n\ntype API interface {\n\t" + tt.iface + "\n}\n"
+			if err := os.WriteFile(filepath.Join(dir, "api.go"), []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ParseAPI(dir, "API")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
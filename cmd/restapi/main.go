@@ -0,0 +1,79 @@
+// Command restapi generates the implementation of an annotated interface on github.com/crochee/rest
+// together with a gomock compatible mock.
+//
+// Every method takes a context.Context first and returns an error last, optionally preceded by a result
+// decoded from the JSON response. The request is described by annotations in the method comment:
+//
+//	//go:generate go run github.com/crochee/rest/cmd/restapi -type BookAPI
+//	type BookAPI interface {
+//		// @GET /v2/projects/{project}/books/{id}
+//		Get(ctx context.Context, project, id string) (*Book, error)
+//		// @GET /v2/books
+//		// @Query opts
+//		// @Query limit
+//		List(ctx context.Context, opts *ListOptions, limit int) (*BookList, error)
+//		// @POST /v2/books
+//		// @Header X-Request-Id requestID
+//		// @Body book
+//		// @Status 201
+//		Create(ctx context.Context, requestID string, book *Book) (*Book, error)
+//	}
+//
+// Placeholders of the path are bound to the parameters of the same name, @Query binds a parameter
+// of basic type to the query key of its name, or the key given after it, other parameters are encoded
+// by Querys. Every parameter but the context must be bound. @Status lists the expected status codes,
+// by default 200, and 201 for POST, 204 for DELETE.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		typeName = flag.String("type", "", "name of the annotated interface")
+		dir      = flag.String("dir", ".", "directory of the package declaring the interface")
+		output   = flag.String("o", "", "output file of the implementation, defaults to <type>_rest.go")
+		mock     = flag.String("mock", "", "output file of the mock, defaults to <type>_mock.go, - to skip")
+	)
+	flag.Parse()
+	if err := run(*typeName, *dir, *output, *mock); err != nil {
+		fmt.Fprintln(os.Stderr, "restapi:", err)
+		os.Exit(1)
+	}
+}
+
+func run(typeName, dir, output, mock string) error {
+	if typeName == "" {
+		return fmt.Errorf("-type is required")
+	}
+	api, err := ParseAPI(dir, typeName)
+	if err != nil {
+		return err
+	}
+	base := strings.ToLower(typeName)
+	if output == "" {
+		output = filepath.Join(dir, base+"_rest.go")
+	}
+	src, err := GenerateClient(api)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(output, src, 0o644); err != nil {
+		return err
+	}
+	if mock == "-" {
+		return nil
+	}
+	if mock == "" {
+		mock = filepath.Join(dir, base+"_mock.go")
+	}
+	if src, err = GenerateMock(api); err != nil {
+		return err
+	}
+	return os.WriteFile(mock, src, 0o644)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// API is an annotated interface
+type API struct {
+	Package string
+	Name    string
+	Methods []*Method
+	// imports referenced by the method signatures, by name
+	Imports map[string]string
+}
+
+// Method is an annotated method of the interface, e.g.
+//
+//	// @GET /v2/projects/{project}/books/{id}
+//	// @Query opts
+//	// @Header X-Request-Id requestID
+//	// @Body book
+//	// @Status 200 201
+type Method struct {
+	Name    string
+	Verb    string
+	Path    string
+	Params  []*Param
+	Result  string
+	Status  []int
+	Queries []*Binding
+	Headers []*Binding
+	Body    string
+}
+
+type Param struct {
+	Name string
+	Type string
+	// Basic is set for parameters of basic types, which are formatted by fmt.Sprint
+	Basic bool
+}
+
+// Binding binds a parameter to a query or header key, Key is empty for
+// parameters encoded by Querys
+type Binding struct {
+	Key   string
+	Param *Param
+}
+
+var verbs = map[string]string{
+	"GET": http.MethodGet, "POST": http.MethodPost, "PUT": http.MethodPut,
+	"PATCH": http.MethodPatch, "DELETE": http.MethodDelete, "HEAD": http.MethodHead,
+}
+
+// ParseAPI finds the interface typeName in the go files of dir
+func ParseAPI(dir, typeName string) (*API, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != typeName {
+					continue
+				}
+				iface, ok := ts.Type.(*ast.InterfaceType)
+				if !ok {
+					return nil, fmt.Errorf("%s is not an interface", typeName)
+				}
+				return parseInterface(fset, file, typeName, iface)
+			}
+		}
+	}
+	return nil, fmt.Errorf("interface %s not found in %s", typeName, dir)
+}
+
+func parseInterface(fset *token.FileSet, file *ast.File, name string, iface *ast.InterfaceType) (*API, error) {
+	api := &API{Package: file.Name.Name, Name: name, Imports: make(map[string]string)}
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		importName := path[strings.LastIndexByte(path, '/')+1:]
+		if spec.Name != nil {
+			importName = spec.Name.Name
+		}
+		imports[importName] = path
+	}
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) != 1 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m, err := parseMethod(field.Names[0].Name, field.Doc, fn)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", fset.Position(field.Pos()), field.Names[0].Name, err)
+		}
+		api.Methods = append(api.Methods, m)
+		// keep the imports referenced by the signature
+		ast.Inspect(fn, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok {
+					if path, found := imports[id.Name]; found {
+						api.Imports[id.Name] = path
+					}
+				}
+			}
+			return true
+		})
+	}
+	return api, nil
+}
+
+func parseMethod(name string, doc *ast.CommentGroup, fn *ast.FuncType) (*Method, error) {
+	m := &Method{Name: name}
+	params := make(map[string]*Param)
+	for i, field := range fn.Params.List {
+		typ := types.ExprString(field.Type)
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return nil, fmt.Errorf("variadic parameters are not supported")
+		}
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("parameters must be named")
+		}
+		for _, id := range field.Names {
+			if i == 0 && len(m.Params) == 0 {
+				if typ != "context.Context" {
+					return nil, fmt.Errorf("the first parameter must be context.Context")
+				}
+			}
+			p := &Param{Name: id.Name, Type: typ, Basic: isBasic(field.Type)}
+			m.Params = append(m.Params, p)
+			params[id.Name] = p
+		}
+	}
+	if len(m.Params) == 0 {
+		return nil, fmt.Errorf("the first parameter must be context.Context")
+	}
+
+	results := fn.Results
+	switch {
+	case results == nil || len(results.List) == 0:
+		return nil, fmt.Errorf("the last result must be error")
+	case len(results.List) > 2 || (len(results.List) == 2 && len(results.List[0].Names) > 1):
+		return nil, fmt.Errorf("at most one result besides error is supported")
+	}
+	if types.ExprString(results.List[len(results.List)-1].Type) != "error" {
+		return nil, fmt.Errorf("the last result must be error")
+	}
+	if len(results.List) == 2 {
+		m.Result = types.ExprString(results.List[0].Type)
+	}
+
+	if doc == nil {
+		return nil, fmt.Errorf("missing annotation like // @GET /path")
+	}
+	for _, c := range doc.List {
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/*"))
+		if !strings.HasPrefix(text, "@") {
+			continue
+		}
+		fields := strings.Fields(text[1:])
+		if len(fields) == 0 {
+			continue
+		}
+		annotation, args := strings.ToUpper(fields[0]), fields[1:]
+		if verb, ok := verbs[annotation]; ok {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("@%s needs a path", annotation)
+			}
+			m.Verb, m.Path = verb, args[0]
+			continue
+		}
+		switch annotation {
+		case "QUERY":
+			if len(args) == 0 || len(args) > 2 {
+				return nil, fmt.Errorf("usage: @Query param [key]")
+			}
+			p, ok := params[args[0]]
+			if !ok {
+				return nil, fmt.Errorf("@Query: unknown parameter %s", args[0])
+			}
+			b := &Binding{Param: p}
+			switch {
+			case len(args) == 2:
+				b.Key = args[1]
+			case p.Basic:
+				b.Key = p.Name
+			}
+			m.Queries = append(m.Queries, b)
+		case "HEADER":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("usage: @Header Key param")
+			}
+			p, ok := params[args[1]]
+			if !ok {
+				return nil, fmt.Errorf("@Header: unknown parameter %s", args[1])
+			}
+			m.Headers = append(m.Headers, &Binding{Key: args[0], Param: p})
+		case "BODY":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("usage: @Body param")
+			}
+			if _, ok := params[args[0]]; !ok {
+				return nil, fmt.Errorf("@Body: unknown parameter %s", args[0])
+			}
+			m.Body = args[0]
+		case "STATUS":
+			for _, arg := range args {
+				code, err := strconv.Atoi(arg)
+				if err != nil {
+					return nil, fmt.Errorf("@Status: %w", err)
+				}
+				m.Status = append(m.Status, code)
+			}
+		default:
+			return nil, fmt.Errorf("unknown annotation @%s", fields[0])
+		}
+	}
+	if m.Verb == "" {
+		return nil, fmt.Errorf("missing annotation like // @GET /path")
+	}
+	if len(m.Status) == 0 {
+		m.Status = defaultStatus(m.Verb)
+	}
+	bound := map[string]bool{m.Params[0].Name: true, m.Body: true}
+	for _, placeholder := range placeholders(m.Path) {
+		if _, ok := params[placeholder]; !ok {
+			return nil, fmt.Errorf("no parameter for path placeholder {%s}", placeholder)
+		}
+		bound[placeholder] = true
+	}
+	for _, b := range m.Queries {
+		bound[b.Param.Name] = true
+	}
+	for _, b := range m.Headers {
+		bound[b.Param.Name] = true
+	}
+	for _, p := range m.Params {
+		if !bound[p.Name] {
+			return nil, fmt.Errorf("parameter %s is not bound to the path, a query, a header or the body", p.Name)
+		}
+	}
+	return m, nil
+}
+
+func defaultStatus(verb string) []int {
+	switch verb {
+	case http.MethodPost:
+		return []int{http.StatusOK, http.StatusCreated}
+	case http.MethodDelete:
+		return []int{http.StatusOK, http.StatusNoContent}
+	default:
+		return []int{http.StatusOK}
+	}
+}
+
+// placeholders returns the names of the {name} placeholders of path
+func placeholders(path string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(path, '{')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(path[start:], '}')
+		if end < 0 {
+			return names
+		}
+		names = append(names, path[start+1:start+end])
+		path = path[start+end+1:]
+	}
+}
+
+func isBasic(expr ast.Expr) bool {
+	id, ok := expr.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	switch id.Name {
+	case "string", "bool", "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+		return true
+	}
+	return false
+}
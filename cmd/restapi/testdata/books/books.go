@@ -0,0 +1,44 @@
+package books
+
+import (
+	"context"
+	"time"
+)
+
+type Book struct {
+	Name      string     `json:"name"`
+	Published *time.Time `json:"published,omitempty"`
+}
+
+type BookList struct {
+	List  []Book `json:"list"`
+	Total int    `json:"total"`
+}
+
+type ListOptions struct {
+	Offset int      `form:"offset"`
+	Tags   []string `form:"tags,style=comma"`
+}
+
+type BookAPI interface {
+	// @GET /v2/projects/{project}/books/{id}
+	Get(ctx context.Context, project, id string) (*Book, error)
+	// @GET /v2/books
+	// @Query opts
+	// @Query limit
+	List(ctx context.Context, opts *ListOptions, limit int) (*BookList, error)
+	// @POST /v2/books
+	// @Header X-Request-Id requestID
+	// @Body book
+	// @Status 201
+	Create(ctx context.Context, requestID string, book *Book) (*Book, error)
+	// @DELETE /v2/books/{id}
+	// @Header If-Unmodified-Since since
+	Delete(ctx context.Context, id int, since time.Time) error
+	// @PUT /v2/books/{c}/archive
+	// @Query result
+	// @Query err error
+	// @Header X-Http http
+	// @Body time
+	Archive(ctx context.Context, c string, result int, err bool, http string, time Book) (Book, error)
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type generator struct {
+	spec    *Spec
+	types   bytes.Buffer
+	svc     bytes.Buffer
+	imports map[string]bool
+	// names of the declared types
+	declared map[string]bool
+}
+
+// Generate generates the Go types of the component schemas and a service per tag
+// built on rest.Handler
+func Generate(spec *Spec, pkg string) ([]byte, error) {
+	g := &generator{
+		spec:     spec,
+		imports:  make(map[string]bool),
+		declared: make(map[string]bool),
+	}
+	for _, name := range sortedKeys(spec.Components.Schemas) {
+		if err := g.declare(goName(name), spec.Components.Schemas[name]); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	if err := g.services(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by restgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	if len(g.imports) != 0 {
+		// standard packages come first, separated from the others
+		var std, others []string
+		for _, path := range sortedKeys(g.imports) {
+			if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+				others = append(others, path)
+				continue
+			}
+			std = append(std, path)
+		}
+		out.WriteString("import (\n")
+		for _, path := range std {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		if len(std) != 0 && len(others) != 0 {
+			out.WriteString("\n")
+		}
+		for _, path := range others {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.types.Bytes())
+	out.Write(g.svc.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func comment(buf *bytes.Buffer, text string) {
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(buf, "// %s\n", line)
+		}
+	}
+}
+
+// declare declares the type name for the schema
+func (g *generator) declare(name string, schema *Schema) error {
+	if g.declared[name] {
+		return nil
+	}
+	g.declared[name] = true
+	var buf bytes.Buffer
+	comment(&buf, schema.Description)
+	switch {
+	case isStruct(schema):
+		fmt.Fprintf(&buf, "type %s struct {\n", name)
+		if err := g.fields(&buf, name, schema); err != nil {
+			return err
+		}
+		buf.WriteString("}\n\n")
+	case schema.Type == "string" && len(schema.Enum) != 0:
+		fmt.Fprintf(&buf, "type %s string\n\nconst (\n", name)
+		for _, value := range schema.Enum {
+			s := fmt.Sprint(value)
+			fmt.Fprintf(&buf, "\t%s%s %s = %q\n", name, goName(s), name, s)
+		}
+		buf.WriteString(")\n\n")
+	default:
+		typ, err := g.goType(schema, name+"Item")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "type %s %s\n\n", name, typ)
+	}
+	g.types.Write(buf.Bytes())
+	return nil
+}
+
+func isStruct(schema *Schema) bool {
+	return len(schema.Properties) != 0 || len(schema.AllOf) > 1 ||
+		(len(schema.AllOf) == 1 && schema.AllOf[0].Ref == "")
+}
+
+func (g *generator) fields(buf *bytes.Buffer, name string, schema *Schema) error {
+	for _, sub := range schema.AllOf {
+		if sub.Ref != "" {
+			// referenced schemas are embedded
+			fmt.Fprintf(buf, "\t%s\n", goName(refName(sub.Ref)))
+			continue
+		}
+		if err := g.fields(buf, name, sub); err != nil {
+			return err
+		}
+	}
+	required := make(map[string]bool, len(schema.Required))
+	for _, property := range schema.Required {
+		required[property] = true
+	}
+	for _, property := range sortedKeys(schema.Properties) {
+		propertySchema := schema.Properties[property]
+		fieldName := goName(property)
+		typ, err := g.goType(propertySchema, name+fieldName)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", property, err)
+		}
+		tag := property
+		if !required[property] {
+			tag += ",omitempty"
+			if g.isStructType(propertySchema) {
+				typ = "*" + typ
+			}
+		}
+		comment(buf, propertySchema.Description)
+		fmt.Fprintf(buf, "\t%s %s `json:%q`\n", fieldName, typ, tag)
+	}
+	return nil
+}
+
+// isStructType reports whether the Go type of schema is a struct
+func (g *generator) isStructType(schema *Schema) bool {
+	if schema == nil {
+		return false
+	}
+	if schema.Ref != "" {
+		referenced, ok := g.spec.Components.Schemas[refName(schema.Ref)]
+		return ok && isStruct(referenced)
+	}
+	return isStruct(schema) || schema.Format == "date-time"
+}
+
+// goType returns the Go type of schema, inline objects are declared as hint
+func (g *generator) goType(schema *Schema, hint string) (string, error) {
+	if schema == nil {
+		return "interface{}", nil
+	}
+	if schema.Ref != "" {
+		name := refName(schema.Ref)
+		if _, ok := g.spec.Components.Schemas[name]; !ok {
+			return "", fmt.Errorf("unresolved schema %s", schema.Ref)
+		}
+		return goName(name), nil
+	}
+	if len(schema.AllOf) == 1 && schema.AllOf[0].Ref != "" && len(schema.Properties) == 0 {
+		return g.goType(schema.AllOf[0], hint)
+	}
+	if isStruct(schema) {
+		return hint, g.declare(hint, schema)
+	}
+	switch schema.Type {
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time", nil
+		case "byte":
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		switch schema.Format {
+		case "int32":
+			return "int32", nil
+		case "int64":
+			return "int64", nil
+		}
+		return "int", nil
+	case "number":
+		if schema.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		item, err := g.goType(schema.Items, hint+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object", "":
+		additional := bytes.TrimSpace(schema.AdditionalProperties)
+		if len(additional) != 0 && additional[0] == '{' {
+			var value Schema
+			if err := json.Unmarshal(additional, &value); err != nil {
+				return "", err
+			}
+			elem, err := g.goType(&value, hint+"Value")
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + elem, nil
+		}
+		if schema.Type == "object" {
+			return "map[string]interface{}", nil
+		}
+		return "interface{}", nil
+	}
+	return "", fmt.Errorf("unsupported schema type %q", schema.Type)
+}
+
+type operation struct {
+	method string
+	path   string
+	name   string
+	*Operation
+}
+
+func (g *generator) services() error {
+	byTag := make(map[string][]operation)
+	for _, p := range sortedKeys(g.spec.Paths) {
+		item := g.spec.Paths[p]
+		operations := item.Operations()
+		for _, method := range sortedKeys(operations) {
+			op := operations[method]
+			tag := "Default"
+			if len(op.Tags) != 0 {
+				tag = op.Tags[0]
+			}
+			name := op.OperationID
+			if name == "" {
+				name = strings.ToLower(method) + " " + p
+			}
+			merged := *op
+			// parameters of the path item are overridden by those of the operation
+			merged.Parameters = append(append([]*Parameter(nil), item.Parameters...), op.Parameters...)
+			byTag[tag] = append(byTag[tag], operation{method: method, path: p, name: goName(name), Operation: &merged})
+		}
+	}
+	for _, tag := range sortedKeys(byTag) {
+		if err := g.service(goName(tag), byTag[tag]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type param struct {
+	name string
+	arg  string
+	typ  string
+	*Parameter
+}
+
+type method struct {
+	operation
+	pathParams  []param
+	queryParams []param
+	bodyType    string
+	resultType  string
+	statusCodes []string
+}
+
+func (g *generator) service(tag string, operations []operation) error {
+	methods := make([]*method, 0, len(operations))
+	for _, op := range operations {
+		m, err := g.method(op)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", op.method, op.path, err)
+		}
+		methods = append(methods, m)
+	}
+
+	iface, impl := tag+"Service", argName(tag)+"Service"
+	g.imports["context"] = true
+	g.imports["net/http"] = true
+	g.imports["github.com/crochee/rest"] = true
+
+	fmt.Fprintf(&g.svc, "type %s interface {\n", iface)
+	for _, m := range methods {
+		comment(&g.svc, m.Summary)
+		fmt.Fprintf(&g.svc, "\t%s\n", m.signature())
+	}
+	g.svc.WriteString("}\n\n")
+
+	fmt.Fprintf(&g.svc, "func New%s(handler rest.Handler) %s {\n\treturn &%s{handler: handler}\n}\n\n", iface, iface, impl)
+	fmt.Fprintf(&g.svc, "type %s struct {\n\thandler rest.Handler\n}\n\n", impl)
+	for _, m := range methods {
+		fmt.Fprintf(&g.svc, "func (s *%s) %s {\n", impl, m.signature())
+		g.body(m)
+		g.svc.WriteString("}\n\n")
+	}
+	return nil
+}
+
+func (g *generator) method(op operation) (*method, error) {
+	m := &method{operation: op}
+	seen := make(map[string]int)
+	var params []param
+	for _, p := range op.Parameters {
+		resolved, err := g.spec.parameter(p)
+		if err != nil {
+			return nil, err
+		}
+		key := resolved.In + "/" + resolved.Name
+		typ, err := g.goType(resolved.Schema, op.name+goName(resolved.Name))
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", resolved.Name, err)
+		}
+		pa := param{name: goName(resolved.Name), arg: argName(resolved.Name), typ: typ, Parameter: resolved}
+		if i, ok := seen[key]; ok {
+			params[i] = pa
+			continue
+		}
+		seen[key] = len(params)
+		params = append(params, pa)
+	}
+	for _, p := range params {
+		switch p.In {
+		case "path":
+			m.pathParams = append(m.pathParams, p)
+		case "query":
+			m.queryParams = append(m.queryParams, p)
+		}
+	}
+	for _, p := range m.pathParams {
+		if !strings.Contains(op.path, "{"+p.Name+"}") {
+			return nil, fmt.Errorf("path parameter %s is not in the path", p.Name)
+		}
+	}
+	if strings.Count(op.path, "{") != len(m.pathParams) {
+		return nil, fmt.Errorf("every placeholder of the path must be declared as path parameter")
+	}
+	// path parameters are passed in the order of the path
+	sort.SliceStable(m.pathParams, func(i, j int) bool {
+		return strings.Index(op.path, "{"+m.pathParams[i].Name+"}") < strings.Index(op.path, "{"+m.pathParams[j].Name+"}")
+	})
+	if len(m.queryParams) != 0 {
+		if err := g.queryType(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if op.RequestBody != nil {
+		body, err := g.spec.requestBody(op.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		if schema := jsonSchema(body.Content); schema != nil {
+			if m.bodyType, err = g.goType(schema, op.name+"Request"); err != nil {
+				return nil, fmt.Errorf("request body: %w", err)
+			}
+		}
+	}
+
+	for _, code := range sortedKeys(op.Responses) {
+		codes := successCodes(code)
+		if len(codes) == 0 {
+			continue
+		}
+		for _, c := range codes {
+			if !containsString(m.statusCodes, c) {
+				m.statusCodes = append(m.statusCodes, c)
+			}
+		}
+		if m.resultType != "" {
+			continue
+		}
+		resp, err := g.spec.response(op.Responses[code])
+		if err != nil {
+			return nil, err
+		}
+		if schema := jsonSchema(resp.Content); schema != nil {
+			if m.resultType, err = g.goType(schema, op.name+"Response"); err != nil {
+				return nil, fmt.Errorf("response %s: %w", code, err)
+			}
+		}
+	}
+	if len(m.statusCodes) == 0 {
+		m.statusCodes = []string{"200"}
+	}
+	return m, nil
+}
+
+// successCodes returns the 2xx status codes of the response key, the range 2XX is expanded
+// to the codes known by net/http, the other keys have none
+func successCodes(key string) []string {
+	if strings.EqualFold(key, "2XX") {
+		var codes []string
+		for code := 200; code < 300; code++ {
+			if http.StatusText(code) != "" {
+				codes = append(codes, strconv.Itoa(code))
+			}
+		}
+		return codes
+	}
+	code, err := strconv.Atoi(key)
+	if err != nil || code < 200 || code > 299 {
+		return nil
+	}
+	return []string{strconv.Itoa(code)}
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// queryType declares the struct holding the query parameters of m,
+// the style of OpenAPI is translated into the style option of rest.QueryEncoder
+func (g *generator) queryType(m *method) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %sQuery struct {\n", m.name)
+	for _, p := range m.queryParams {
+		tag := p.Name
+		if !p.Required {
+			tag += ",omitempty"
+		}
+		explode := p.Explode == nil || *p.Explode
+		switch {
+		case p.Style == "deepObject":
+			tag += ",style=deepObject"
+		case p.Style == "spaceDelimited":
+			tag += ",style=spaceDelimited"
+		case p.Style == "pipeDelimited":
+			tag += ",style=pipeDelimited"
+		case !explode:
+			tag += ",style=comma"
+		}
+		typ := p.typ
+		if !p.Required && g.isStructType(p.Schema) {
+			typ = "*" + typ
+		}
+		comment(&buf, p.Description)
+		fmt.Fprintf(&buf, "\t%s %s `form:%q`\n", p.name, typ, tag)
+	}
+	buf.WriteString("}\n\n")
+	g.types.Write(buf.Bytes())
+	return nil
+}
+
+func (m *method) signature() string {
+	args := []string{"ctx context.Context"}
+	for _, p := range m.pathParams {
+		args = append(args, p.arg+" "+p.typ)
+	}
+	if len(m.queryParams) != 0 {
+		args = append(args, "query *"+m.name+"Query")
+	}
+	if m.bodyType != "" {
+		args = append(args, "body "+pointer(m.bodyType))
+	}
+	result := "error"
+	if m.resultType != "" {
+		result = "(" + pointer(m.resultType) + ", error)"
+	}
+	return fmt.Sprintf("%s(%s) %s", m.name, strings.Join(args, ", "), result)
+}
+
+// pointer returns the type passed by pointer, slices and maps are passed as they are
+func pointer(typ string) string {
+	if strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || typ == "interface{}" {
+		return typ
+	}
+	return "*" + typ
+}
+
+func (g *generator) body(m *method) {
+	if m.resultType != "" {
+		fmt.Fprintf(&g.svc, "\tvar result %s\n", m.resultType)
+	}
+	fmt.Fprintf(&g.svc, "\terr := s.handler.To().Method(http.Method%s).\n", methodConst(m.method))
+	g.path(m)
+	if len(m.queryParams) != 0 {
+		g.svc.WriteString("\t\tEncoder(rest.NewQueryEncoder()).\n\t\tQuerys(query).\n")
+	}
+	if m.bodyType != "" {
+		g.svc.WriteString("\t\tBody(body).\n")
+	}
+	target := "nil"
+	if m.resultType != "" {
+		target = "&result"
+	}
+	fmt.Fprintf(&g.svc, "\t\tDo(ctx, %s, rest.ErrorFunc(%s))\n", target, strings.Join(m.statusCodes, ", "))
+	if m.resultType == "" {
+		g.svc.WriteString("\treturn err\n")
+		return
+	}
+	g.svc.WriteString("\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	if pointer(m.resultType) == m.resultType {
+		g.svc.WriteString("\treturn result, nil\n")
+		return
+	}
+	g.svc.WriteString("\treturn &result, nil\n")
+}
+
+// path writes the path of m, a path like /v2/books/{id}/chapters is built by
+// Prefix("v2").Resource("books").Name(id).SubResource("chapters"),
+// other paths by Path with the template
+func (g *generator) path(m *method) {
+	segments := strings.Split(strings.Trim(m.path, "/"), "/")
+	placeholder := -1
+	for i, segment := range segments {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+		if placeholder >= 0 || i == 0 || segment[0] != '{' || segment[len(segment)-1] != '}' ||
+			strings.Count(segment, "{") != 1 {
+			g.pathTemplate(m)
+			return
+		}
+		placeholder = i
+	}
+	resource := len(segments) - 1
+	if placeholder >= 0 {
+		resource = placeholder - 1
+	}
+	if segments[resource] == "" {
+		return
+	}
+	if resource > 0 {
+		fmt.Fprintf(&g.svc, "\t\tPrefix(%s).\n", quoteAll(segments[:resource]))
+	}
+	fmt.Fprintf(&g.svc, "\t\tResource(%q).\n", segments[resource])
+	if placeholder < 0 {
+		return
+	}
+	fmt.Fprintf(&g.svc, "\t\tName(%s).\n", m.pathParams[0].stringExpr(g))
+	if sub := segments[placeholder+1:]; len(sub) != 0 {
+		fmt.Fprintf(&g.svc, "\t\tSubResource(%s).\n", quoteAll(sub))
+	}
+}
+
+func (g *generator) pathTemplate(m *method) {
+	fmt.Fprintf(&g.svc, "\t\tPath(%q, map[string]string{\n", m.path)
+	for _, p := range m.pathParams {
+		fmt.Fprintf(&g.svc, "\t\t\t%q: %s,\n", p.Name, p.stringExpr(g))
+	}
+	g.svc.WriteString("\t\t}).\n")
+}
+
+func (p param) stringExpr(g *generator) string {
+	if p.typ == "string" {
+		return p.arg
+	}
+	g.imports["fmt"] = true
+	return "fmt.Sprint(" + p.arg + ")"
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func methodConst(method string) string {
+	return method[:1] + strings.ToLower(method[1:])
+}
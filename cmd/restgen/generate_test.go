@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	specs, err := filepath.Glob(filepath.Join("testdata", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) == 0 {
+		t.Fatal("no spec in testdata")
+	}
+	for _, specFile := range specs {
+		name := strings.TrimSuffix(filepath.Base(specFile), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			spec, err := LoadSpec(specFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Generate(spec, "client")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err = os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("generated code differs from %s, run go test -update to accept it:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestSuccessCodes(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "200", want: "200"},
+		{key: "204", want: "204"},
+		{key: "2XX", want: "200,201,202,203,204,205,206,207,208,226"},
+		{key: "2xx", want: "200,201,202,203,204,205,206,207,208,226"},
+		{key: "404", want: ""},
+		{key: "4XX", want: ""},
+		{key: "default", want: ""},
+		{key: "2X0", want: ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(successCodes(tt.key), ","); got != tt.want {
+			t.Errorf("successCodes(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
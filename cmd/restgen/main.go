@@ -0,0 +1,53 @@
+// Command restgen generates Go types and typed clients built on github.com/crochee/rest
+// from an OpenAPI 3 document in JSON or YAML.
+//
+// Usage:
+//
+//	//go:generate restgen -spec openapi.yaml -package books -o client.go
+//
+// Every tag of the document becomes a service interface with an implementation on rest.Handler,
+// the handler given to the constructor should only carry the endpoint and the defaults.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var (
+		spec   = flag.String("spec", "", "path of the OpenAPI 3 document, .json, .yaml or .yml")
+		pkg    = flag.String("package", "", "package name of the generated code, defaults to $GOPACKAGE")
+		output = flag.String("o", "", "output file, defaults to stdout")
+	)
+	flag.Parse()
+	if err := run(*spec, *pkg, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "restgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specFile, pkg, output string) error {
+	if specFile == "" {
+		return fmt.Errorf("-spec is required")
+	}
+	if pkg == "" {
+		if pkg = os.Getenv("GOPACKAGE"); pkg == "" {
+			return fmt.Errorf("-package is required")
+		}
+	}
+	spec, err := LoadSpec(specFile)
+	if err != nil {
+		return err
+	}
+	src, err := Generate(spec, pkg)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(output, src, 0o644)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+var commonInitialisms = map[string]bool{
+	"API": true, "HTTP": true, "ID": true, "IP": true, "JSON": true, "URL": true, "URI": true, "UUID": true,
+}
+
+// goName converts an identifier like book_id or listBooks into an exported Go name like BookID or ListBooks
+func goName(s string) string {
+	var words []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words = append(words, splitCamel(field)...)
+	}
+	var sb strings.Builder
+	for _, word := range words {
+		if upper := strings.ToUpper(word); commonInitialisms[upper] {
+			sb.WriteString(upper)
+			continue
+		}
+		runes := []rune(word)
+		sb.WriteRune(unicode.ToUpper(runes[0]))
+		sb.WriteString(string(runes[1:]))
+	}
+	name := sb.String()
+	if name == "" {
+		return "X"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// argName converts an identifier into an unexported Go name usable as argument
+func argName(s string) string {
+	name := goName(s)
+	runes := []rune(name)
+	i := 0
+	for i < len(runes) && unicode.IsUpper(runes[i]) {
+		i++
+	}
+	switch {
+	case i > 1 && i < len(runes):
+		// keep the first letter of the next word upper, e.g. IDList -> idList
+		i--
+	}
+	name = strings.ToLower(string(runes[:i])) + string(runes[i:])
+	if token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
+
+// splitCamel splits listBooksByID into list, Books, By, ID
+func splitCamel(s string) []string {
+	var (
+		words []string
+		start int
+	)
+	runes := []rune(s)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && (!unicode.IsUpper(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewCoalescingRoundTripper returns a RoundTripper sending a single request to roundTripper for the
+// concurrent GET and HEAD requests with the same URL and values of headers, the response body is read
+// into memory and shared by all of them, so it must not be used for streams.
+// The credential headers Authorization, Proxy-Authorization and Cookie are always part of the key,
+// so that the requests of different users are never shared.
+// A caller canceling its request leaves the others waiting, the upstream request is canceled
+// when no caller waits for it anymore
+func NewCoalescingRoundTripper(roundTripper http.RoundTripper, headers ...string) http.RoundTripper {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	names := []string{"Authorization", "Proxy-Authorization", "Cookie"}
+	for _, name := range headers {
+		if name = http.CanonicalHeaderKey(name); !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return &coalescingRoundTripper{next: roundTripper, headers: names, calls: make(map[string]*coalescedCall)}
+}
+
+type coalescingRoundTripper struct {
+	next    http.RoundTripper
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done    chan struct{}
+	waiters int
+	cancel  context.CancelFunc
+
+	resp *http.Response
+	body []byte
+	err  error
+	// md is recorded by the RoundTrippers after this one, for every caller
+	md Metadata
+}
+
+func (c *coalescingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) ||
+		(req.Body != nil && req.Body != http.NoBody) {
+		return c.next.RoundTrip(req)
+	}
+	key := c.key(req)
+	c.mu.Lock()
+	call, shared := c.calls[key]
+	if !shared {
+		// the upstream request must outlive the caller starting it,
+		// and records its metadata into the call rather than into the Metadata of that caller
+		ctx, cancel := context.WithCancel(valueContext{req.Context()})
+		call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+		ctx = WithMetadata(ctx, &call.md)
+		c.calls[key] = call
+		go c.do(key, call, req.Clone(ctx))
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-req.Context().Done():
+		c.mu.Lock()
+		if call.waiters--; call.waiters == 0 {
+			call.cancel()
+			if c.calls[key] == call {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+		return nil, req.Context().Err()
+	}
+	if md := MetadataFrom(req.Context()); md != nil {
+		md.Cache = call.md.Cache
+		md.RateLimitWait += call.md.RateLimitWait
+		md.Hedged = call.md.Hedged
+		md.Coalesced = shared
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	resp := *call.resp
+	resp.Header = call.resp.Header.Clone()
+	resp.Trailer = call.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(call.body))
+	resp.Request = req
+	return &resp, nil
+}
+
+func (c *coalescingRoundTripper) do(key string, call *coalescedCall, req *http.Request) {
+	defer call.cancel()
+	resp, err := c.next.RoundTrip(req)
+	if err == nil {
+		call.body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.ContentLength = int64(len(call.body))
+		resp.TransferEncoding = nil
+		resp.Uncompressed = false
+		call.resp = resp
+	}
+	call.err = err
+	c.mu.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+func (c *coalescingRoundTripper) key(req *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString(req.Method)
+	sb.WriteByte(' ')
+	sb.WriteString(req.URL.String())
+	for _, name := range c.headers {
+		sb.WriteByte('\n')
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+// valueContext keeps the values of its parent but not its deadline nor cancellation
+type valueContext struct {
+	context.Context
+}
+
+func (valueContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (valueContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (valueContext) Err() error {
+	return nil
+}
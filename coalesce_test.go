@@ -0,0 +1,202 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescingMetadata(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"a"}`))
+	}))
+	defer server.Close()
+
+	coalescing := NewCoalescingRoundTripper(
+		NewCacheRoundTripper(http.DefaultTransport, NewMemoryCache(1<<20))).(*coalescingRoundTripper)
+	client := DefaultTransport.WithClient(coalescing).Method(http.MethodGet).Endpoints(server.URL)
+	const callers = 4
+	mds := make([]Metadata, callers)
+	var wg sync.WaitGroup
+	for i := range mds {
+		wg.Add(1)
+		go func(md *Metadata) {
+			defer wg.Done()
+			var result map[string]string
+			if err := client.Do(WithMetadata(context.Background(), md), &result); err != nil {
+				t.Error(err)
+				return
+			}
+			if result["name"] != "a" {
+				t.Errorf("result %v", result)
+			}
+		}(&mds[i])
+	}
+	waitFor(t, func() bool {
+		coalescing.mu.Lock()
+		defer coalescing.mu.Unlock()
+		for _, call := range coalescing.calls {
+			return call.waiters == callers
+		}
+		return false
+	})
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("%d upstream calls, want 1", got)
+	}
+	var coalesced int
+	for _, md := range mds {
+		if md.Cache != CacheMiss || md.StatusCode != http.StatusOK {
+			t.Errorf("metadata %+v", md)
+		}
+		if md.Coalesced {
+			coalesced++
+		}
+	}
+	if coalesced != callers-1 {
+		t.Errorf("%d coalesced, want %d", coalesced, callers-1)
+	}
+
+	var md Metadata
+	if err := client.DoNop(WithMetadata(context.Background(), &md)); err != nil {
+		t.Fatal(err)
+	}
+	if md.Cache != CacheHit || md.Coalesced {
+		t.Errorf("metadata %+v", md)
+	}
+}
+
+func TestCoalescingKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		a, b    http.Header
+		want    int32
+	}{
+		{
+			name: "same request",
+			want: 1,
+		},
+		{
+			name: "authorization",
+			a:    http.Header{"Authorization": {"Bearer a"}},
+			b:    http.Header{"Authorization": {"Bearer b"}},
+			want: 2,
+		},
+		{
+			name: "cookie",
+			a:    http.Header{"Cookie": {"session=a"}},
+			b:    http.Header{"Cookie": {"session=b"}},
+			want: 2,
+		},
+		{
+			name: "ignored header",
+			a:    http.Header{"Accept-Language": {"en"}},
+			b:    http.Header{"Accept-Language": {"fr"}},
+			want: 1,
+		},
+		{
+			name:    "configured header",
+			headers: []string{"accept-language"},
+			a:       http.Header{"Accept-Language": {"en"}},
+			b:       http.Header{"Accept-Language": {"fr"}},
+			want:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+			}))
+			defer server.Close()
+
+			coalescing := NewCoalescingRoundTripper(http.DefaultTransport, tt.headers...).(*coalescingRoundTripper)
+			client := DefaultTransport.WithClient(coalescing).Method(http.MethodGet).Endpoints(server.URL)
+			var wg sync.WaitGroup
+			for _, header := range []http.Header{tt.a, tt.b} {
+				wg.Add(1)
+				go func(header http.Header) {
+					defer wg.Done()
+					if err := client.Headers(header).DoNop(context.Background()); err != nil {
+						t.Error(err)
+					}
+				}(header)
+			}
+			waitFor(t, func() bool {
+				coalescing.mu.Lock()
+				defer coalescing.mu.Unlock()
+				var waiters int
+				for _, call := range coalescing.calls {
+					waiters += call.waiters
+				}
+				return waiters == 2
+			})
+			close(release)
+			wg.Wait()
+			if got := atomic.LoadInt32(&calls); got != tt.want {
+				t.Errorf("%d upstream calls, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoalescingCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	coalescing := NewCoalescingRoundTripper(http.DefaultTransport).(*coalescingRoundTripper)
+	client := DefaultTransport.WithClient(coalescing).Method(http.MethodGet).Endpoints(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- client.DoNop(ctx)
+	}()
+	waitFor(t, func() bool {
+		coalescing.mu.Lock()
+		defer coalescing.mu.Unlock()
+		return len(coalescing.calls) == 1
+	})
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("expected an error")
+	}
+	coalescing.mu.Lock()
+	defer coalescing.mu.Unlock()
+	if len(coalescing.calls) != 0 {
+		t.Errorf("%d calls left", len(coalescing.calls))
+	}
+}
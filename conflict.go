@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// UpdateWithRetry reads, mutates and writes an object until the write doesn't conflict,
+// a write failing with 409 or 412 fetches the object again and reapplies mutate with backoff.
+// put receives the ETag of the object got, which should be sent with IfMatch, e.g.
+//
+//	err := rest.UpdateWithRetry(ctx,
+//		func(ctx context.Context) (*Book, error) {
+//			var book Book
+//			return &book, handler.To().Method(http.MethodGet).Name(id).Do(ctx, &book, rest.ErrorFunc(http.StatusOK))
+//		},
+//		func(book *Book) error {
+//			book.Stock--
+//			return nil
+//		},
+//		func(ctx context.Context, book *Book, etag string) error {
+//			return handler.To().Method(http.MethodPut).Name(id).IfMatch(etag).Body(book).DoNop(ctx, rest.ErrorFunc(http.StatusOK))
+//		})
+func UpdateWithRetry[T any](ctx context.Context, get func(ctx context.Context) (*T, error),
+	mutate func(obj *T) error, put func(ctx context.Context, obj *T, etag string) error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 10 * time.Millisecond
+	b.MaxInterval = time.Second
+	return UpdateWithBackOff(ctx, backoff.WithMaxRetries(b, 5), get, mutate, put)
+}
+
+// UpdateWithBackOff is UpdateWithRetry waiting between the conflicting writes with b
+func UpdateWithBackOff[T any](ctx context.Context, b backoff.BackOff, get func(ctx context.Context) (*T, error),
+	mutate func(obj *T) error, put func(ctx context.Context, obj *T, etag string) error) error {
+	return backoff.Retry(func() error {
+		var md Metadata
+		obj, err := get(WithMetadata(ctx, &md))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if err = mutate(obj); err != nil {
+			return backoff.Permanent(err)
+		}
+		if err = put(ctx, obj, md.ETag); err != nil && !IsConflict(err) && !IsPreconditionFailed(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(b, ctx))
+}
+
+// UpdateWithRetry updates the object name with If-Match until it doesn't conflict, see UpdateWithRetry
+func (c *ResourceClient[T, ListT]) UpdateWithRetry(ctx context.Context, name string, mutate func(obj *T) error) (*T, error) {
+	var result *T
+	err := UpdateWithRetry(ctx,
+		func(ctx context.Context) (*T, error) {
+			return c.Get(ctx, name)
+		},
+		mutate,
+		func(ctx context.Context, obj *T, etag string) error {
+			if etag == "" {
+				return errors.New("the object has no ETag")
+			}
+			var updated T
+			if err := c.handler.To().Method(http.MethodPut).Name(name).IfMatch(etag).Body(obj).
+				Do(ctx, &updated, ErrorFunc(http.StatusOK, http.StatusAccepted)); err != nil {
+				return err
+			}
+			result = &updated
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// conflictServer serves a book whose version is bumped by a concurrent writer before each of the first
+// conflicts writes, the writes are rejected with status unless If-Match is the current ETag
+type conflictServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	book      testBook
+	version   int
+	conflicts int
+	status    int
+	gets      int
+	ifMatch   []string
+}
+
+func newConflictServer(conflicts, status int) *conflictServer {
+	s := &conflictServer{book: testBook{Name: "go"}, conflicts: conflicts, status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		etag := strconv.Quote("v" + strconv.Itoa(s.version))
+		switch r.Method {
+		case http.MethodGet:
+			s.gets++
+		case http.MethodPut:
+			s.ifMatch = append(s.ifMatch, r.Header.Get("If-Match"))
+			if s.conflicts != 0 {
+				// another client wrote in between
+				s.conflicts--
+				s.version++
+			}
+			if r.Header.Get("If-Match") != strconv.Quote("v"+strconv.Itoa(s.version)) {
+				w.WriteHeader(s.status)
+				_, _ = w.Write([]byte(`{"code":"Conflict"}`))
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&s.book); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.version++
+			etag = strconv.Quote("v" + strconv.Itoa(s.version))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		_ = json.NewEncoder(w).Encode(s.book)
+	}))
+	return s
+}
+
+func TestResourceClientUpdateWithRetry(t *testing.T) {
+	for _, status := range []int{http.StatusConflict, http.StatusPreconditionFailed} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			server := newConflictServer(2, status)
+			defer server.Close()
+			client := NewResourceClient[testBook, testBookList](NewHandler().Endpoint(server.URL).Resource("books"))
+			book, err := client.UpdateWithRetry(context.Background(), "go", func(book *testBook) error {
+				book.Name += "!"
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if book.Name != "go!" || server.book.Name != "go!" {
+				t.Errorf("updated %s, stored %s, want go!", book.Name, server.book.Name)
+			}
+			if server.gets != 3 {
+				t.Errorf("fetched %d times, want 3", server.gets)
+			}
+			want := []string{`"v0"`, `"v1"`, `"v2"`}
+			if !equalStrings(server.ifMatch, want) {
+				t.Errorf("If-Match %v, want %v", server.ifMatch, want)
+			}
+		})
+	}
+}
+
+func TestUpdateWithBackOffGivesUp(t *testing.T) {
+	server := newConflictServer(-1, http.StatusPreconditionFailed)
+	defer server.Close()
+	client := NewResourceClient[testBook, testBookList](NewHandler().Endpoint(server.URL).Resource("books"))
+	mutations := 0
+	err := UpdateWithBackOff(context.Background(), backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2),
+		func(ctx context.Context) (*testBook, error) {
+			return client.Get(ctx, "go")
+		},
+		func(book *testBook) error {
+			mutations++
+			return nil
+		},
+		func(ctx context.Context, book *testBook, etag string) error {
+			return NewHandler().Endpoint(server.URL).To().Method(http.MethodPut).Resource("books").Name("go").
+				IfMatch(etag).Body(book).DoNop(ctx, ErrorFunc(http.StatusOK))
+		})
+	if !IsPreconditionFailed(err) {
+		t.Fatalf("error %v, want precondition failed", err)
+	}
+	if mutations != 3 || len(server.ifMatch) != 3 {
+		t.Errorf("mutated %d times and wrote %d times, want 3", mutations, len(server.ifMatch))
+	}
+}
+
+func TestUpdateWithRetryPermanentErrors(t *testing.T) {
+	errMutate := errors.New("mutate")
+	tests := []struct {
+		name   string
+		mutate func(*testBook) error
+		status int
+		want   func(error) bool
+	}{
+		{
+			name:   "mutate",
+			mutate: func(*testBook) error { return errMutate },
+			status: http.StatusConflict,
+			want:   func(err error) bool { return errors.Is(err, errMutate) },
+		},
+		{
+			name:   "not a conflict",
+			mutate: func(*testBook) error { return nil },
+			status: http.StatusForbidden,
+			want:   func(err error) bool { return IsStatus(err, http.StatusForbidden) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newConflictServer(-1, tt.status)
+			defer server.Close()
+			client := NewResourceClient[testBook, testBookList](NewHandler().Endpoint(server.URL).Resource("books"))
+			_, err := client.UpdateWithRetry(context.Background(), "go", tt.mutate)
+			if !tt.want(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if server.gets != 1 {
+				t.Errorf("fetched %d times, want 1", server.gets)
+			}
+		})
+	}
+}
@@ -2,25 +2,68 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 )
 
-func ErrorFunc(expectStatusCode int) func(*http.Response) error {
+// StatusError is returned when the response has an unexpected status code
+type StatusError struct {
+	StatusCode int         `json:"-"`
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	Result     interface{} `json:"result"`
+	// Err is the error decoding the body, if any
+	Err error `json:"-"`
+}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("code:%s, message:%s, result:%v", e.Code, e.Message, e.Result)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// IsStatus reports whether err is a StatusError with the status code
+func IsStatus(err error, statusCode int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
+
+func IsNotFound(err error) bool {
+	return IsStatus(err, http.StatusNotFound)
+}
+
+func IsConflict(err error) bool {
+	return IsStatus(err, http.StatusConflict)
+}
+
+func IsPreconditionFailed(err error) bool {
+	return IsStatus(err, http.StatusPreconditionFailed)
+}
+
+// ErrorFunc returns a *StatusError decoded from the body if the status code is none of the expected,
+// it wraps the error decoding the body and keeps its message
+func ErrorFunc(expectStatusCode int, moreStatusCodes ...int) func(*http.Response) error {
 	return func(resp *http.Response) error {
-		if resp.StatusCode != expectStatusCode {
-			decoder := json.NewDecoder(resp.Body)
-			decoder.UseNumber()
-			var result struct {
-				Code    string      `json:"code"`
-				Message string      `json:"message"`
-				Result  interface{} `json:"result"`
-			}
-			if err := decoder.Decode(&result); err != nil {
-				return err
+		if resp.StatusCode == expectStatusCode {
+			return nil
+		}
+		for _, statusCode := range moreStatusCodes {
+			if resp.StatusCode == statusCode {
+				return nil
 			}
-			return fmt.Errorf("code:%s, message:%s, result:%v", result.Code, result.Message, result.Result)
 		}
-		return nil
+		result := &StatusError{StatusCode: resp.StatusCode}
+		decoder := json.NewDecoder(resp.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(result); err != nil {
+			result.Err = err
+		}
+		return result
 	}
 }
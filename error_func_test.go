@@ -0,0 +1,72 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorFunc(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       string
+		decodeErr  bool
+	}{
+		{
+			name:       "expected",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "more expected",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "decoded",
+			statusCode: http.StatusConflict,
+			body:       `{"code":"Conflict","message":"exists","result":1}`,
+			want:       "code:Conflict, message:exists, result:1",
+		},
+		{
+			name:       "not json",
+			statusCode: http.StatusBadGateway,
+			body:       "<html>bad gateway</html>",
+			want:       "invalid character '<' looking for beginning of value",
+			decodeErr:  true,
+		},
+		{
+			name:       "empty",
+			statusCode: http.StatusInternalServerError,
+			want:       io.EOF.Error(),
+			decodeErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ErrorFunc(http.StatusOK, http.StatusNoContent)(&http.Response{
+				StatusCode: tt.statusCode,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			})
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("error %v, want %s", err, tt.want)
+			}
+			if !IsStatus(err, tt.statusCode) {
+				t.Errorf("error %v, want status %d", err, tt.statusCode)
+			}
+			var syntaxErr *json.SyntaxError
+			if decodeErr := errors.As(err, &syntaxErr) || errors.Is(err, io.EOF); decodeErr != tt.decodeErr {
+				t.Errorf("wraps the decode error %t, want %t", decodeErr, tt.decodeErr)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 module github.com/crochee/rest
 
-go 1.17
+go 1.18
 
 require (
 	github.com/cenkalti/backoff/v4 v4.1.3
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/golang/mock v1.6.0
 	github.com/gorilla/schema v1.2.0
 	go.uber.org/multierr v1.8.0
+	golang.org/x/text v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require go.uber.org/atomic v1.10.0 // indirect
+require (
+	go.uber.org/atomic v1.10.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+)
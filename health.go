@@ -0,0 +1,225 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheckOption configures the HealthChecker created by NewHealthChecker
+type HealthCheckOption func(*HealthChecker)
+
+// WithHealthPath sets the path probed on every endpoint, /health by default
+func WithHealthPath(path string) HealthCheckOption {
+	return func(h *HealthChecker) {
+		h.path = path
+	}
+}
+
+// WithHealthInterval sets the interval of the probes, 10s by default
+func WithHealthInterval(interval time.Duration) HealthCheckOption {
+	return func(h *HealthChecker) {
+		h.interval = interval
+	}
+}
+
+// WithHealthTransport sets the transport sending the probes, DefaultTransport by default
+func WithHealthTransport(transport Transport) HealthCheckOption {
+	return func(h *HealthChecker) {
+		h.transport = transport
+	}
+}
+
+// WithEjectionFailures sets the number of consecutive failures ejecting an endpoint, 5 by default
+func WithEjectionFailures(failures int) HealthCheckOption {
+	return func(h *HealthChecker) {
+		h.failures = failures
+	}
+}
+
+// WithEjectionErrorRate ejects an endpoint when the rate of failed requests within an interval
+// reaches rate, once there are at least minRequests requests. The interval is that of
+// WithHealthInterval, with or without Run. It is disabled by default
+func WithEjectionErrorRate(rate float64, minRequests int) HealthCheckOption {
+	return func(h *HealthChecker) {
+		h.errorRate = rate
+		h.minRequests = minRequests
+	}
+}
+
+// WithCoolDown sets how long an endpoint stays ejected, 30s by default
+func WithCoolDown(coolDown time.Duration) HealthCheckOption {
+	return func(h *HealthChecker) {
+		h.coolDown = coolDown
+	}
+}
+
+// HealthChecker is a Balancer ejecting the unhealthy endpoints before picking among the others
+// with its inner balancer. An endpoint is ejected for a cool-down after consecutive failures
+// or a high error rate of the requests and the probes, the probes are sent by Run. e.g.
+//
+//	checker := rest.NewHealthChecker(rest.NewBalancer(rest.RoundRobin), rest.WithHealthPath("/healthz"))
+//	go checker.Run(ctx)
+//	transport := rest.ConfigureTransport(rest.DefaultTransport, rest.WithBalancer(checker))
+type HealthChecker struct {
+	balancer    Balancer
+	transport   Transport
+	path        string
+	interval    time.Duration
+	failures    int
+	errorRate   float64
+	minRequests int
+	coolDown    time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointHealth
+}
+
+type endpointHealth struct {
+	consecutiveFailures int
+	// requests and errors of the interval started at windowStart
+	requests     int
+	errors       int
+	windowStart  time.Time
+	ejectedUntil time.Time
+	lastSeen     time.Time
+}
+
+func NewHealthChecker(balancer Balancer, opts ...HealthCheckOption) *HealthChecker {
+	h := &HealthChecker{
+		balancer:  balancer,
+		transport: DefaultTransport,
+		path:      "/health",
+		interval:  10 * time.Second,
+		failures:  5,
+		coolDown:  30 * time.Second,
+		now:       time.Now,
+		endpoints: make(map[string]*endpointHealth),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Pick picks an endpoint with the inner balancer among those which are not ejected,
+// or among all of them if they are all ejected
+func (h *HealthChecker) Pick(endpoints []string, tried []string) string {
+	h.mu.Lock()
+	now := h.now()
+	healthy := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		health := h.health(endpoint)
+		health.lastSeen = now
+		if !now.Before(health.ejectedUntil) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	h.mu.Unlock()
+	if len(healthy) == 0 {
+		healthy = endpoints
+	}
+	return h.balancer.Pick(healthy, tried)
+}
+
+// Done records the result of a request, failing with an error or a 5xx status code
+func (h *HealthChecker) Done(endpoint string, resp *http.Response, err error) {
+	h.balancer.Done(endpoint, resp, err)
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrBulkheadFull) {
+		// the endpoint is not to blame
+		return
+	}
+	h.record(endpoint, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+}
+
+// Healthy reports whether endpoint is not ejected
+func (h *HealthChecker) Healthy(endpoint string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	health, ok := h.endpoints[endpoint]
+	return !ok || !h.now().Before(health.ejectedUntil)
+}
+
+// Run probes the endpoints picked from at every interval until ctx is done
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var wg sync.WaitGroup
+		for _, endpoint := range h.reset() {
+			wg.Add(1)
+			go func(endpoint string) {
+				defer wg.Done()
+				probeCtx, cancel := context.WithTimeout(ctx, h.interval)
+				defer cancel()
+				err := h.transport.Method(http.MethodGet).Endpoints(endpoint).Prefix(h.path).
+					DoNop(probeCtx, ErrorFunc(http.StatusOK, http.StatusNoContent))
+				if ctx.Err() == nil {
+					h.record(endpoint, err != nil)
+				}
+			}(endpoint)
+		}
+		wg.Wait()
+	}
+}
+
+// reset starts a new interval and returns the endpoints to probe,
+// the endpoints not picked from for a while are forgotten
+func (h *HealthChecker) reset() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	endpoints := make([]string, 0, len(h.endpoints))
+	for endpoint, health := range h.endpoints {
+		if now.Sub(health.lastSeen) > 10*h.interval && !now.Before(health.ejectedUntil) {
+			delete(h.endpoints, endpoint)
+			continue
+		}
+		health.requests, health.errors, health.windowStart = 0, 0, now
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+func (h *HealthChecker) record(endpoint string, failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	health := h.health(endpoint)
+	now := h.now()
+	if now.Sub(health.windowStart) >= h.interval {
+		// the error rate is that of the last interval, even without Run
+		health.requests, health.errors, health.windowStart = 0, 0, now
+	}
+	health.requests++
+	if !failed {
+		health.consecutiveFailures = 0
+		return
+	}
+	health.errors++
+	health.consecutiveFailures++
+	if health.consecutiveFailures >= h.failures ||
+		(h.errorRate > 0 && health.requests >= h.minRequests &&
+			float64(health.errors) >= h.errorRate*float64(health.requests)) {
+		health.ejectedUntil = now.Add(h.coolDown)
+		health.consecutiveFailures = 0
+		health.requests, health.errors = 0, 0
+	}
+}
+
+func (h *HealthChecker) health(endpoint string) *endpointHealth {
+	health, ok := h.endpoints[endpoint]
+	if !ok {
+		now := h.now()
+		health = &endpointHealth{lastSeen: now, windowStart: now}
+		h.endpoints[endpoint] = health
+	}
+	return health
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testHealthChecker(now *time.Time, opts ...HealthCheckOption) *HealthChecker {
+	h := NewHealthChecker(NewBalancer(RoundRobin), opts...)
+	h.now = func() time.Time { return *now }
+	return h
+}
+
+var errHealthTest = errors.New("connection refused")
+
+func TestHealthCheckerEjection(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	h := testHealthChecker(&now, WithEjectionFailures(3), WithCoolDown(time.Minute))
+	endpoints := []string{"http://a", "http://b"}
+	h.Done("http://a", nil, errHealthTest)
+	h.Done("http://a", &http.Response{StatusCode: http.StatusOK}, nil)
+	h.Done("http://a", nil, errHealthTest)
+	h.Done("http://a", &http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	// the caller canceling is not a failure
+	h.Done("http://a", nil, context.Canceled)
+	if !h.Healthy("http://a") {
+		t.Fatal("ejected after 2 consecutive failures")
+	}
+	h.Done("http://a", nil, errHealthTest)
+	if h.Healthy("http://a") {
+		t.Fatal("not ejected after 3 consecutive failures")
+	}
+	for i := 0; i < 4; i++ {
+		if got := h.Pick(endpoints, nil); got != "http://b" {
+			t.Fatalf("picked %s, want the healthy endpoint", got)
+		}
+	}
+
+	// all the endpoints are picked from when they are all ejected
+	for i := 0; i < 3; i++ {
+		h.Done("http://b", nil, errHealthTest)
+	}
+	picked := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		picked[h.Pick(endpoints, nil)] = true
+	}
+	if len(picked) != 2 {
+		t.Errorf("picked %v, want both endpoints", picked)
+	}
+
+	// the endpoints recover after the cool-down
+	now = now.Add(time.Minute)
+	if !h.Healthy("http://a") || !h.Healthy("http://b") {
+		t.Error("still ejected after the cool-down")
+	}
+}
+
+func TestHealthCheckerErrorRate(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	h := testHealthChecker(&now, WithEjectionFailures(100), WithEjectionErrorRate(0.5, 4),
+		WithHealthInterval(10*time.Second))
+	ok := &http.Response{StatusCode: http.StatusOK}
+
+	// an old burst of errors is forgotten without Run
+	h.Done("http://a", nil, errHealthTest)
+	h.Done("http://a", nil, errHealthTest)
+	h.Done("http://a", nil, errHealthTest)
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		h.Done("http://a", ok, nil)
+	}
+	h.Done("http://a", nil, errHealthTest)
+	if !h.Healthy("http://a") {
+		t.Fatal("ejected by the errors of a previous interval")
+	}
+
+	h.Done("http://a", nil, errHealthTest)
+	h.Done("http://a", nil, errHealthTest)
+	if h.Healthy("http://a") {
+		t.Fatal("not ejected at an error rate of 0.5")
+	}
+}
+
+func TestHealthCheckerRun(t *testing.T) {
+	var healthy int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	h := NewHealthChecker(NewBalancer(RoundRobin), WithHealthPath("/healthz"),
+		WithHealthInterval(5*time.Millisecond), WithEjectionFailures(1), WithCoolDown(20*time.Millisecond))
+	// the probed endpoints are those picked from
+	h.Pick([]string{server.URL, down.URL}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, func() bool { return !h.Healthy(down.URL) })
+	if !h.Healthy(server.URL) {
+		t.Error("healthy endpoint ejected")
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	waitFor(t, func() bool { return !h.Healthy(server.URL) })
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(t, func() bool { return h.Healthy(server.URL) })
+}
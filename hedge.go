@@ -0,0 +1,189 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HedgeOption configures the RoundTripper created by NewHedgingRoundTripper
+type HedgeOption func(*hedgingRoundTripper)
+
+// WithHedgeBudget sets the percentage of the requests which may be hedged, 10 by default.
+// The budget is earned by the requests, so no request is hedged before 100/percent requests
+func WithHedgeBudget(percent float64) HedgeOption {
+	return func(h *hedgingRoundTripper) {
+		h.ratio = percent / 100
+	}
+}
+
+// NewHedgingRoundTripper returns a RoundTripper sending a second attempt of the GET and HEAD requests
+// to roundTripper when the first one has not answered after delay, like the 95th percentile of
+// the latency. The first response is returned and the other attempt is canceled.
+// For a client with several endpoints, the second attempt is sent to another endpoint picked by
+// the balancer, and Metadata.Endpoint is the endpoint of the response
+func NewHedgingRoundTripper(roundTripper http.RoundTripper, delay time.Duration, opts ...HedgeOption) http.RoundTripper {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	h := &hedgingRoundTripper{next: roundTripper, delay: delay, ratio: 0.1}
+	for _, opt := range opts {
+		opt(h)
+	}
+	// a burst of hedges is limited to 10 or to the budget of 100 requests
+	h.maxTokens = math.Max(10, 100*h.ratio)
+	return h
+}
+
+type hedgingRoundTripper struct {
+	next      http.RoundTripper
+	delay     time.Duration
+	ratio     float64
+	maxTokens float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+type hedgeResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+func (h *hedgingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) ||
+		(req.Body != nil && req.Body != http.NoBody) {
+		return h.next.RoundTrip(req)
+	}
+	h.deposit()
+	md := MetadataFrom(req.Context())
+	attempt := endpointAttemptFrom(req.Context())
+	var (
+		results = make(chan hedgeResult, 2)
+		cancels []context.CancelFunc
+		// every attempt records into its own Metadata, the one of the response is kept
+		mds []*Metadata
+		// endpoints of the attempts, when the balancer of the client picks them
+		endpoints []string
+	)
+	start := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		attemptMD := &Metadata{}
+		if md != nil {
+			*attemptMD = *md
+			ctx = WithMetadata(ctx, attemptMD)
+		}
+		attemptReq := req.Clone(ctx)
+		if attempt != nil {
+			endpoint := attempt.endpoint
+			if len(cancels) != 0 {
+				// the hedge goes to another endpoint than the slow one
+				attemptReq, endpoint = attempt.pick(attemptReq)
+				attemptMD.Endpoint = endpoint
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		mds = append(mds, attemptMD)
+		go func() {
+			resp, err := h.next.RoundTrip(attemptReq)
+			results <- hedgeResult{index: index, resp: resp, err: err}
+		}()
+	}
+	// report sends the result of an attempt which is not returned to the balancer,
+	// the one returned is reported by the client
+	report := func(index int, resp *http.Response, err error) {
+		if attempt != nil {
+			attempt.done(endpoints[index], resp, err)
+		}
+	}
+	start()
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) == 1 && h.withdraw() {
+				start()
+				pending++
+			}
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				cancels[result.index]()
+				if pending == 0 {
+					if attempt != nil {
+						attempt.endpoint = endpoints[result.index]
+					}
+					return nil, result.err
+				}
+				report(result.index, nil, result.err)
+				continue
+			}
+			for i, cancel := range cancels {
+				if i != result.index {
+					cancel()
+				}
+			}
+			if pending != 0 {
+				go drainHedges(results, pending, report)
+			}
+			if md != nil {
+				*md = *mds[result.index]
+				md.Hedged = len(cancels) > 1
+			}
+			if attempt != nil {
+				attempt.endpoint = endpoints[result.index]
+			}
+			result.resp.Body = &cancelBody{ReadCloser: result.resp.Body, cancel: cancels[result.index]}
+			return result.resp, nil
+		}
+	}
+}
+
+// deposit earns the budget of a request
+func (h *hedgingRoundTripper) deposit() {
+	h.mu.Lock()
+	h.tokens = math.Min(h.maxTokens, h.tokens+h.ratio)
+	h.mu.Unlock()
+}
+
+// withdraw spends the budget of a hedge
+func (h *hedgingRoundTripper) withdraw() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// drainHedges closes and reports the responses of the canceled attempts
+func drainHedges(results <-chan hedgeResult, pending int, report func(int, *http.Response, error)) {
+	for ; pending > 0; pending-- {
+		result := <-results
+		if result.err == nil {
+			result.resp.Body.Close()
+		}
+		report(result.index, result.resp, result.err)
+	}
+}
+
+// cancelBody cancels the context of its request once closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type hedgeTestKey struct{}
+
+// hedgeTestRequest is the state of a request sent by hedgeSend
+type hedgeTestRequest struct {
+	slow     bool
+	attempts int32
+	canceled int32
+}
+
+// hedgeTestRoundTripper answers the first attempt of the slow requests once its context is done,
+// and the other attempts at once
+var hedgeTestRoundTripper = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+	r := req.Context().Value(hedgeTestKey{}).(*hedgeTestRequest)
+	if atomic.AddInt32(&r.attempts, 1) == 1 && r.slow {
+		<-req.Context().Done()
+		atomic.AddInt32(&r.canceled, 1)
+		return nil, req.Context().Err()
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}, nil
+})
+
+func hedgeSend(t *testing.T, rt http.RoundTripper, method string, slow bool) (*Metadata, *hedgeTestRequest, error) {
+	t.Helper()
+	md := &Metadata{}
+	r := &hedgeTestRequest{slow: slow}
+	ctx, cancel := context.WithTimeout(WithMetadata(context.WithValue(context.Background(), hedgeTestKey{}, r), md),
+		100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, method, "http://localhost:80/books", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return md, r, err
+	}
+	return md, r, resp.Body.Close()
+}
+
+func TestHedgingDelay(t *testing.T) {
+	rt := NewHedgingRoundTripper(hedgeTestRoundTripper, 20*time.Millisecond, WithHedgeBudget(100))
+	start := time.Now()
+	md, r, err := hedgeSend(t, rt, http.MethodGet, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("hedged after %s, want the delay", elapsed)
+	}
+	if !md.Hedged {
+		t.Error("Metadata.Hedged not set")
+	}
+	// the slow attempt is canceled once the hedge answered
+	waitFor(t, func() bool { return atomic.LoadInt32(&r.canceled) == 1 })
+	if got := atomic.LoadInt32(&r.attempts); got != 2 {
+		t.Errorf("%d attempts, want 2", got)
+	}
+
+	// a response within the delay is not hedged
+	rt = NewHedgingRoundTripper(hedgeTestRoundTripper, time.Hour, WithHedgeBudget(100))
+	if md, r, err = hedgeSend(t, rt, http.MethodGet, false); err != nil {
+		t.Fatal(err)
+	}
+	if md.Hedged || atomic.LoadInt32(&r.attempts) != 1 {
+		t.Errorf("hedged %t with %d attempts, want a single attempt", md.Hedged, r.attempts)
+	}
+}
+
+func TestHedgingBudget(t *testing.T) {
+	rt := NewHedgingRoundTripper(hedgeTestRoundTripper, time.Millisecond, WithHedgeBudget(25))
+	hedged := func(slow bool) bool {
+		t.Helper()
+		md, _, _ := hedgeSend(t, rt, http.MethodGet, slow)
+		return md.Hedged
+	}
+	// 4 requests earn a hedge at 25%
+	for i := 0; i < 3; i++ {
+		hedged(false)
+	}
+	if !hedged(true) {
+		t.Fatal("not hedged with the budget of 4 requests")
+	}
+	for i := 0; i < 3; i++ {
+		if hedged(true) {
+			t.Fatalf("request %d hedged beyond the budget", i)
+		}
+	}
+	if !hedged(true) {
+		t.Fatal("not hedged with the budget earned again")
+	}
+}
+
+func TestHedgingUnsafeMethods(t *testing.T) {
+	var attempts int32
+	rt := NewHedgingRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(20 * time.Millisecond)
+		return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}, nil
+	}), time.Millisecond, WithHedgeBudget(100))
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		md, _, err := hedgeSend(t, rt, method, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Hedged {
+			t.Errorf("%s hedged", method)
+		}
+	}
+	if got := atomic.LoadInt32(&attempts); got != 4 {
+		t.Errorf("%d attempts, want 4", got)
+	}
+}
+
+func TestHedgingErrors(t *testing.T) {
+	errFirst := errors.New("first")
+	var attempts int32
+	rt := NewHedgingRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(10 * time.Millisecond)
+			return nil, errFirst
+		}
+		time.Sleep(30 * time.Millisecond)
+		return nil, errors.New("hedge")
+	}), time.Millisecond, WithHedgeBudget(100))
+	// the attempt failing last is returned
+	if _, _, err := hedgeSend(t, rt, http.MethodGet, false); err == nil || err.Error() != "hedge" {
+		t.Errorf("error %v, want hedge", err)
+	}
+}
+
+func TestHedgingOtherEndpoint(t *testing.T) {
+	var slowRequests, fastRequests int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowRequests, 1)
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fastRequests, 1)
+	}))
+	defer fast.Close()
+
+	hedging := NewHedgingRoundTripper(http.DefaultTransport, 10*time.Millisecond, WithHedgeBudget(100))
+	balancer := &inFlightBalancer{Balancer: NewBalancer(RoundRobin), inFlight: make(map[string]int)}
+	client := ConfigureTransport(DefaultTransport.WithClient(hedging), WithBalancer(balancer)).
+		Method(http.MethodGet).Endpoints(slow.URL, fast.URL)
+	for i := 0; i < 4; i++ {
+		var md Metadata
+		ctx, cancel := context.WithTimeout(WithMetadata(context.Background(), &md), 5*time.Second)
+		err := client.DoNop(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the round robin balancer picks the slow endpoint first, then the other one for the hedge
+		if md.Endpoint != fast.URL || !md.Hedged {
+			t.Errorf("answered by %s, hedged %t, want the hedge to %s", md.Endpoint, md.Hedged, fast.URL)
+		}
+	}
+	if got := atomic.LoadInt32(&slowRequests); got != 4 {
+		t.Errorf("%d requests to the slow endpoint, want 4", got)
+	}
+	if got := atomic.LoadInt32(&fastRequests); got != 4 {
+		t.Errorf("%d requests to the fast endpoint, want 4", got)
+	}
+	// both attempts are reported to the balancer
+	waitFor(t, func() bool {
+		balancer.mu.Lock()
+		defer balancer.mu.Unlock()
+		return balancer.inFlight[slow.URL] == 0 && balancer.inFlight[fast.URL] == 0
+	})
+}
+
+// inFlightBalancer counts the attempts picked and not done yet
+type inFlightBalancer struct {
+	Balancer
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func (b *inFlightBalancer) Pick(endpoints []string, tried []string) string {
+	endpoint := b.Balancer.Pick(endpoints, tried)
+	b.mu.Lock()
+	b.inFlight[endpoint]++
+	b.mu.Unlock()
+	return endpoint
+}
+
+func (b *inFlightBalancer) Done(endpoint string, resp *http.Response, err error) {
+	b.Balancer.Done(endpoint, resp, err)
+	b.mu.Lock()
+	b.inFlight[endpoint]--
+	b.mu.Unlock()
+}
@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPTransportOption configures the http.Transport created by NewHTTPTransport
+type HTTPTransportOption func(*http.Transport)
+
+// NewHTTPTransport returns an http.Transport configured like http.DefaultTransport,
+// which also dials the endpoints on a unix socket given to RESTClient.Endpoints
+func NewHTTPTransport(opts ...HTTPTransportOption) *http.Transport {
+	t := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if base, ok := http.DefaultTransport.(*http.Transport); ok {
+		t = base.Clone()
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	t.DialContext = dialer.DialContext
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.DialContext = unixDialContext(t.DialContext)
+	if proxy := t.Proxy; proxy != nil {
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			// a unix socket is never proxied
+			if _, ok := unixSocket(req.URL.Hostname()); ok {
+				return nil, nil
+			}
+			return proxy(req)
+		}
+	}
+	return t
+}
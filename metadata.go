@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Metadata describes the response of a request, attach it to the context of the request by WithMetadata
+// to have it filled when the response is received.
+// A Metadata must not be shared by concurrent requests
+type Metadata struct {
+	StatusCode   int
+	Header       http.Header
+	ETag         string
+	LastModified time.Time
+	// Cache is set when the response went through NewCacheRoundTripper
+	Cache CacheStatus
+	// Coalesced is set when the response was shared with a concurrent request by NewCoalescingRoundTripper
+	Coalesced bool
+	// RateLimitWait is the time waited by NewRateLimitRoundTripper
+	RateLimitWait time.Duration
+	// Hedged is set when NewHedgingRoundTripper sent a second attempt
+	Hedged bool
+	// Endpoint is the endpoint the last attempt was sent to
+	Endpoint string
+}
+
+func (m *Metadata) record(resp *http.Response) {
+	m.StatusCode = resp.StatusCode
+	m.Header = resp.Header
+	m.ETag = resp.Header.Get("ETag")
+	m.LastModified = time.Time{}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		m.LastModified, _ = http.ParseTime(lastModified)
+	}
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a context recording the response metadata of the request into md
+func WithMetadata(ctx context.Context, md *Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFrom returns the Metadata attached to ctx by WithMetadata, nil if there is none
+func MetadataFrom(ctx context.Context) *Metadata {
+	md, _ := ctx.Value(metadataKey{}).(*Metadata)
+	return md
+}
+
+type resourceKey struct{}
+
+// resourceFrom returns the path of the resource requested with ctx, empty if the request has no resource
+func resourceFrom(ctx context.Context) string {
+	resource, _ := ctx.Value(resourceKey{}).(string)
+	return resource
+}
@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// JSONPatchType is the media type of RFC 6902 JSON patch
+	JSONPatchType = "application/json-patch+json"
+	// MergePatchType is the media type of RFC 7386 JSON merge patch
+	MergePatchType = "application/merge-patch+json"
+)
+
+// PatchDocument is the body of a PATCH request with its media type
+type PatchDocument interface {
+	Type() string
+	Data() ([]byte, error)
+}
+
+// PatchOperation is an operation of RFC 6902 JSON patch, Op is one of
+// add, remove, replace, move, copy and test
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	switch o.Op {
+	case "add", "replace", "test":
+		// value is required by these operations, even if it is null
+		return json.Marshal(struct {
+			Op    string      `json:"op"`
+			Path  string      `json:"path"`
+			Value interface{} `json:"value"`
+		}{Op: o.Op, Path: o.Path, Value: o.Value})
+	}
+	type operation PatchOperation
+	return json.Marshal(operation(o))
+}
+
+type patch struct {
+	patchType string
+	data      func() ([]byte, error)
+}
+
+func (p patch) Type() string {
+	return p.patchType
+}
+
+func (p patch) Data() ([]byte, error) {
+	return p.data()
+}
+
+// JSONPatch returns a JSON patch of the operations
+func JSONPatch(operations ...PatchOperation) PatchDocument {
+	return patch{patchType: JSONPatchType, data: func() ([]byte, error) {
+		if operations == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(operations)
+	}}
+}
+
+// MergePatch returns a JSON merge patch of obj, which is encoded as JSON unless it is already []byte or string
+func MergePatch(obj interface{}) PatchDocument {
+	return patch{patchType: MergePatchType, data: func() ([]byte, error) {
+		switch t := obj.(type) {
+		case []byte:
+			return t, nil
+		case string:
+			return []byte(t), nil
+		}
+		return json.Marshal(obj)
+	}}
+}
+
+// DiffMergePatch returns the JSON merge patch turning original into modified
+func DiffMergePatch(original, modified interface{}) (PatchDocument, error) {
+	o, err := toJSONValue(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toJSONValue(modified)
+	if err != nil {
+		return nil, err
+	}
+	om, ok1 := o.(map[string]interface{})
+	mm, ok2 := m.(map[string]interface{})
+	if !ok1 || !ok2 {
+		// a merge patch replaces anything but objects
+		return MergePatch(m), nil
+	}
+	return MergePatch(diffMerge(om, mm)), nil
+}
+
+func diffMerge(original, modified map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key := range original {
+		if _, ok := modified[key]; !ok {
+			result[key] = nil
+		}
+	}
+	for key, m := range modified {
+		o, ok := original[key]
+		if !ok {
+			result[key] = m
+			continue
+		}
+		om, ok1 := o.(map[string]interface{})
+		mm, ok2 := m.(map[string]interface{})
+		if ok1 && ok2 {
+			if sub := diffMerge(om, mm); len(sub) != 0 {
+				result[key] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(o, m) {
+			result[key] = m
+		}
+	}
+	return result
+}
+
+// DiffJSONPatch returns the JSON patch turning original into modified,
+// objects are compared member by member, arrays are replaced as a whole
+func DiffJSONPatch(original, modified interface{}) (PatchDocument, error) {
+	o, err := toJSONValue(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toJSONValue(modified)
+	if err != nil {
+		return nil, err
+	}
+	return JSONPatch(diffJSON("", o, m, nil)...), nil
+}
+
+func diffJSON(path string, original, modified interface{}, operations []PatchOperation) []PatchOperation {
+	om, ok1 := original.(map[string]interface{})
+	mm, ok2 := modified.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if !reflect.DeepEqual(original, modified) {
+			operations = append(operations, PatchOperation{Op: "replace", Path: path, Value: modified})
+		}
+		return operations
+	}
+	for _, key := range sortedMapKeys(om) {
+		if _, ok := mm[key]; !ok {
+			operations = append(operations, PatchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+		}
+	}
+	for _, key := range sortedMapKeys(mm) {
+		o, ok := om[key]
+		if !ok {
+			operations = append(operations, PatchOperation{Op: "add", Path: path + "/" + escapePointer(key), Value: mm[key]})
+			continue
+		}
+		operations = diffJSON(path+"/"+escapePointer(key), o, mm[key], operations)
+	}
+	return operations
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes a reference token of RFC 6901 JSON pointer
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// toJSONValue returns the generic JSON representation of v, numbers are kept as json.Number
+func toJSONValue(v interface{}) (interface{}, error) {
+	var data []byte
+	switch t := v.(type) {
+	case []byte:
+		data = t
+	case json.RawMessage:
+		data = t
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
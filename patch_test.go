@@ -0,0 +1,229 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type patchBook struct {
+	Name   string            `json:"name"`
+	Tags   []string          `json:"tags,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Spec   *patchSpec        `json:"spec,omitempty"`
+}
+
+type patchSpec struct {
+	Pages  int    `json:"pages"`
+	Author string `json:"author,omitempty"`
+}
+
+func patchData(t *testing.T, p PatchDocument) string {
+	t.Helper()
+	data, err := p.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDiffMergePatch(t *testing.T) {
+	original := patchBook{
+		Name:   "go",
+		Tags:   []string{"a", "b"},
+		Labels: map[string]string{"keep": "1", "drop": "2", "a/b": "3"},
+		Spec:   &patchSpec{Pages: 100, Author: "rob"},
+	}
+	tests := []struct {
+		name     string
+		original interface{}
+		modified interface{}
+		want     string
+	}{
+		{
+			name:     "unchanged",
+			original: original,
+			modified: original,
+			want:     `{}`,
+		},
+		{
+			name:     "nested objects",
+			original: original,
+			modified: patchBook{
+				Name:   "go",
+				Tags:   []string{"a", "b"},
+				Labels: map[string]string{"keep": "1", "drop": "2", "a/b": "3"},
+				Spec:   &patchSpec{Pages: 120, Author: "rob"},
+			},
+			want: `{"spec":{"pages":120}}`,
+		},
+		{
+			name:     "removals as null",
+			original: original,
+			modified: patchBook{
+				Name:   "go",
+				Tags:   []string{"a", "b"},
+				Labels: map[string]string{"keep": "1", "a/b": "3"},
+			},
+			want: `{"labels":{"drop":null},"spec":null}`,
+		},
+		{
+			name:     "arrays replaced whole",
+			original: original,
+			modified: patchBook{
+				Name:   "go",
+				Tags:   []string{"a", "c"},
+				Labels: map[string]string{"keep": "1", "drop": "2", "a/b": "3"},
+				Spec:   &patchSpec{Pages: 100, Author: "rob"},
+			},
+			want: `{"tags":["a","c"]}`,
+		},
+		{
+			name:     "raw json",
+			original: []byte(`{"a":1,"b":{"c":2}}`),
+			modified: json.RawMessage(`{"a":1.0,"b":{"c":2,"d":[1]}}`),
+			want:     `{"a":1.0,"b":{"d":[1]}}`,
+		},
+		{
+			name:     "not an object",
+			original: []byte(`{"a":1}`),
+			modified: []byte(`[1,2]`),
+			want:     `[1,2]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DiffMergePatch(tt.original, tt.modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Type() != MergePatchType {
+				t.Errorf("type %s, want %s", p.Type(), MergePatchType)
+			}
+			if got := patchData(t, p); got != tt.want {
+				t.Errorf("patch %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := DiffMergePatch([]byte(`{`), original); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestDiffJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		modified string
+		want     string
+	}{
+		{
+			name:     "unchanged",
+			original: `{"a":1}`,
+			modified: `{"a":1}`,
+			want:     `[]`,
+		},
+		{
+			name:     "add, remove and replace",
+			original: `{"a":1,"b":2,"c":{"d":"x"}}`,
+			modified: `{"a":1,"c":{"d":"y","e":null},"f":[1]}`,
+			want: `[{"op":"remove","path":"/b"},{"op":"replace","path":"/c/d","value":"y"},` +
+				`{"op":"add","path":"/c/e","value":null},{"op":"add","path":"/f","value":[1]}]`,
+		},
+		{
+			name:     "arrays replaced whole",
+			original: `{"tags":["a","b"]}`,
+			modified: `{"tags":["a"]}`,
+			want:     `[{"op":"replace","path":"/tags","value":["a"]}]`,
+		},
+		{
+			name:     "escaped pointers",
+			original: `{"a/b":1,"m~n":1}`,
+			modified: `{"a/b":2}`,
+			want:     `[{"op":"remove","path":"/m~0n"},{"op":"replace","path":"/a~1b","value":2}]`,
+		},
+		{
+			name:     "root replaced",
+			original: `{"a":1}`,
+			modified: `"a"`,
+			want:     `[{"op":"replace","path":"","value":"a"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DiffJSONPatch([]byte(tt.original), []byte(tt.modified))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Type() != JSONPatchType {
+				t.Errorf("type %s, want %s", p.Type(), JSONPatchType)
+			}
+			if got := patchData(t, p); got != tt.want {
+				t.Errorf("patch %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchOperationMarshal(t *testing.T) {
+	tests := []struct {
+		op   PatchOperation
+		want string
+	}{
+		{op: PatchOperation{Op: "add", Path: "/a", Value: 1}, want: `{"op":"add","path":"/a","value":1}`},
+		{op: PatchOperation{Op: "replace", Path: "/a"}, want: `{"op":"replace","path":"/a","value":null}`},
+		{op: PatchOperation{Op: "test", Path: "/a", Value: "x"}, want: `{"op":"test","path":"/a","value":"x"}`},
+		{op: PatchOperation{Op: "remove", Path: "/a"}, want: `{"op":"remove","path":"/a"}`},
+		{op: PatchOperation{Op: "move", Path: "/b", From: "/a"}, want: `{"op":"move","path":"/b","from":"/a"}`},
+		{op: PatchOperation{Op: "copy", Path: "/b", From: "/a"}, want: `{"op":"copy","path":"/b","from":"/a"}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s marshaled to %s, want %s", tt.op.Op, data, tt.want)
+		}
+	}
+	if got := patchData(t, JSONPatch()); got != `[]` {
+		t.Errorf("empty patch %s, want []", got)
+	}
+}
+
+func TestEscapePointer(t *testing.T) {
+	tests := map[string]string{
+		"a":    "a",
+		"a/b":  "a~1b",
+		"m~n":  "m~0n",
+		"~/":   "~0~1",
+		"~1":   "~01",
+		"":     "",
+		"/~/~": "~1~0~1~0",
+	}
+	for token, want := range tests {
+		if got := escapePointer(token); got != want {
+			t.Errorf("escapePointer(%q) = %q, want %q", token, got, want)
+		}
+	}
+}
+
+func TestPatchBody(t *testing.T) {
+	var contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentType = req.Header.Get("Content-Type")
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+	p := JSONPatch(PatchOperation{Op: "remove", Path: "/a~1b"})
+	if err := Patch().Endpoints(server.URL).PatchBody(p).DoNop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != JSONPatchType || body != `[{"op":"remove","path":"/a~1b"}]` {
+		t.Errorf("sent %s %s", contentType, body)
+	}
+}
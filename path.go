@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ExpandPathTemplate substitutes the {name} placeholders of template with the percent-escaped
+// values of params and returns the escaped path,
+// text outside placeholders is kept as is, so custom verbs like /books/{id}:archive are supported.
+func ExpandPathTemplate(template string, params map[string]string) (string, error) {
+	var (
+		sb   strings.Builder
+		used = make(map[string]bool, len(params))
+	)
+	for rest := template; rest != ""; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return "", fmt.Errorf("path template %q has unmatched '}'", template)
+			}
+			sb.WriteString(rest)
+			break
+		}
+		if strings.IndexByte(rest[:start], '}') >= 0 {
+			return "", fmt.Errorf("path template %q has unmatched '}'", template)
+		}
+		sb.WriteString(rest[:start])
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("path template %q has unmatched '{'", template)
+		}
+		name := rest[start+1 : start+end]
+		if name == "" || strings.ContainsAny(name, "{/") {
+			return "", fmt.Errorf("path template %q has invalid placeholder %q", template, name)
+		}
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("path template %q: parameter %q is not set", template, name)
+		}
+		if value == "" {
+			return "", fmt.Errorf("path template %q: parameter %q may not be empty", template, name)
+		}
+		for _, illegalName := range NameMayNotBe {
+			if value == illegalName {
+				return "", fmt.Errorf("path template %q: parameter %q may not be '%s'", template, name, illegalName)
+			}
+		}
+		sb.WriteString(url.PathEscape(value))
+		used[name] = true
+		rest = rest[start+end+1:]
+	}
+	if len(used) != len(params) {
+		var unknown []string
+		for name := range params {
+			if !used[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		return "", fmt.Errorf("path template %q has no placeholder for %v", template, unknown)
+	}
+	return sb.String(), nil
+}
+
+// escapePath percent-escapes every segment of the unescaped path p
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpandPathTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		params   map[string]string
+		want     string
+		wantErr  string
+	}{
+		{name: "plain", template: "/books/{id}", params: map[string]string{"id": "12"}, want: "/books/12"},
+		{name: "slash escaped", template: "/books/{id}", params: map[string]string{"id": "a/b"}, want: "/books/a%2Fb"},
+		{
+			name:     "reserved characters",
+			template: "/books/{id}",
+			params:   map[string]string{"id": "a b?#%"},
+			want:     "/books/a%20b%3F%23%25",
+		},
+		{name: "unicode", template: "/books/{id}", params: map[string]string{"id": "书"}, want: "/books/%E4%B9%A6"},
+		{
+			name:     "several",
+			template: "/projects/{project}/books/{id}",
+			params:   map[string]string{"project": "p1", "id": "12"},
+			want:     "/projects/p1/books/12",
+		},
+		{name: "custom verb", template: "/books/{name}:archive", params: map[string]string{"name": "12"}, want: "/books/12:archive"},
+		{name: "no placeholder", template: "/books", want: "/books"},
+		{name: "missing parameter", template: "/books/{id}", wantErr: `parameter "id" is not set`},
+		{
+			name:     "unknown parameter",
+			template: "/books/{id}",
+			params:   map[string]string{"id": "1", "name": "a", "other": "b"},
+			wantErr:  "no placeholder for [name other]",
+		},
+		{name: "empty value", template: "/books/{id}", params: map[string]string{"id": ""}, wantErr: "may not be empty"},
+		{name: "dot dot", template: "/books/{id}", params: map[string]string{"id": ".."}, wantErr: "may not be '..'"},
+		{name: "unmatched open", template: "/books/{id", params: map[string]string{"id": "1"}, wantErr: "unmatched '{'"},
+		{name: "unmatched close", template: "/books/id}", wantErr: "unmatched '}'"},
+		{name: "empty placeholder", template: "/books/{}", wantErr: "invalid placeholder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandPathTemplate(tt.template, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRESTClientPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       func(RESTClient) RESTClient
+		wantURL     string
+		wantPath    string
+		wantRawPath string
+	}{
+		{
+			name: "escaped slash",
+			build: func(r RESTClient) RESTClient {
+				return r.Path("/books/{id}", map[string]string{"id": "a/b"})
+			},
+			wantURL:     "http://localhost:80/v1/books/a%2Fb",
+			wantPath:    "/v1/books/a/b",
+			wantRawPath: "/v1/books/a%2Fb",
+		},
+		{
+			name: "after the resource",
+			build: func(r RESTClient) RESTClient {
+				return r.Resource("projects").Name("p 1").Path("/books/{id}:archive", map[string]string{"id": "12"})
+			},
+			wantURL:  "http://localhost:80/v1/projects/p%201/books/12:archive",
+			wantPath: "/v1/projects/p 1/books/12:archive",
+		},
+		{
+			name: "suffix last",
+			build: func(r RESTClient) RESTClient {
+				return r.Suffix("status").Path("/books/{id}", map[string]string{"id": "a/b"})
+			},
+			wantURL:     "http://localhost:80/v1/books/a%2Fb/status",
+			wantPath:    "/v1/books/a/b/status",
+			wantRawPath: "/v1/books/a%2Fb/status",
+		},
+		{
+			name: "templates joined",
+			build: func(r RESTClient) RESTClient {
+				return r.Path("/projects/{project}", map[string]string{"project": "p1"}).
+					Path("books/{id}", map[string]string{"id": "12"}).Query("a", "1")
+			},
+			wantURL:  "http://localhost:80/v1/projects/p1/books/12?a=1",
+			wantPath: "/v1/projects/p1/books/12",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.build(Get().Endpoints("http://localhost:80/v1")).(*restfulClient)
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			u := r.finalURL()
+			if u.String() != tt.wantURL {
+				t.Errorf("url %s, want %s", u, tt.wantURL)
+			}
+			if u.Path != tt.wantPath {
+				t.Errorf("path %q, want %q", u.Path, tt.wantPath)
+			}
+			if tt.wantRawPath != "" && u.RawPath != tt.wantRawPath {
+				t.Errorf("raw path %q, want %q", u.RawPath, tt.wantRawPath)
+			}
+		})
+	}
+}
+
+func TestRESTClientPathErrors(t *testing.T) {
+	for _, params := range []map[string]string{nil, {"id": "1", "other": "2"}} {
+		if err := Get().Endpoints("http://localhost:80").Path("/books/{id}", params).
+			DoNop(context.Background()); err == nil {
+			t.Errorf("expected an error for %v", params)
+		}
+	}
+}
+
+func TestRESTClientPathSent(t *testing.T) {
+	var rawPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawPath = r.URL.EscapedPath()
+	}))
+	defer server.Close()
+	err := Get().Endpoints(server.URL).Path("/books/{id}:archive", map[string]string{"id": "a/b c"}).
+		DoNop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/books/a%2Fb%20c:archive"; rawPath != want {
+		t.Errorf("sent %q, want %q", rawPath, want)
+	}
+}
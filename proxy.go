@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyRule sends the requests to the hosts matching Hosts through Proxy
+type ProxyRule struct {
+	// Hosts are patterns like those of NO_PROXY: an IP, a CIDR, a domain matching itself and its
+	// subdomains, .domain or *.domain matching only its subdomains, optionally with a port, or * matching all
+	Hosts []string
+	// Proxy is the URL of an http, https or socks5 proxy
+	Proxy string
+	// Username and Password authenticate to the proxy, they replace the user info of Proxy
+	Username string
+	Password string
+}
+
+// ProxyOptions selects the proxy of the requests
+type ProxyOptions struct {
+	// Rules are matched in order, the first rule matching the host of a request selects its proxy
+	Rules []ProxyRule
+	// NoProxy are patterns like those of Hosts of the hosts which are never proxied
+	NoProxy []string
+	// FromEnvironment falls back to the proxy of HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// when no rule matches
+	FromEnvironment bool
+}
+
+// WithProxy sets the proxy of the transport, like the one returned by NewProxyFunc
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) HTTPTransportOption {
+	return func(t *http.Transport) {
+		t.Proxy = proxy
+	}
+}
+
+// NewProxyFunc returns the proxy function of opts for http.Transport. e.g.
+//
+//	proxy, err := rest.NewProxyFunc(rest.ProxyOptions{
+//		Rules:   []rest.ProxyRule{{Hosts: []string{"*.example.com"}, Proxy: "socks5://10.0.0.1:1080"}},
+//		NoProxy: []string{"10.0.0.0/8"},
+//	})
+//	transport := rest.DefaultTransport.WithClient(rest.NewHTTPTransport(rest.WithProxy(proxy)))
+func NewProxyFunc(opts ProxyOptions) (func(*http.Request) (*url.URL, error), error) {
+	type rule struct {
+		hosts []hostPattern
+		proxy *url.URL
+	}
+	rules := make([]rule, len(opts.Rules))
+	for i, r := range opts.Rules {
+		proxy, err := url.Parse(r.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %q: %w", r.Proxy, err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy %q: unsupported scheme %q", r.Proxy, proxy.Scheme)
+		}
+		if r.Username != "" || r.Password != "" {
+			proxy.User = url.UserPassword(r.Username, r.Password)
+		}
+		if rules[i].hosts, err = parseHostPatterns(r.Hosts); err != nil {
+			return nil, err
+		}
+		rules[i].proxy = proxy
+	}
+	noProxy, err := parseHostPatterns(opts.NoProxy)
+	if err != nil {
+		return nil, err
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		host, port := req.URL.Hostname(), req.URL.Port()
+		if port == "" {
+			port = "80"
+			if req.URL.Scheme == "https" {
+				port = "443"
+			}
+		}
+		if matchHostPatterns(noProxy, host, port) {
+			return nil, nil
+		}
+		for _, r := range rules {
+			if matchHostPatterns(r.hosts, host, port) {
+				return r.proxy, nil
+			}
+		}
+		if opts.FromEnvironment {
+			return http.ProxyFromEnvironment(req)
+		}
+		return nil, nil
+	}, nil
+}
+
+// hostPattern is a pattern of NO_PROXY
+type hostPattern struct {
+	all bool
+	// network is set for IPs and CIDRs
+	network *net.IPNet
+	domain  string
+	// subdomainsOnly is set for .domain and *.domain
+	subdomainsOnly bool
+	port           string
+}
+
+func parseHostPatterns(patterns []string) ([]hostPattern, error) {
+	var result []hostPattern
+	for _, pattern := range patterns {
+		for _, p := range strings.Split(pattern, ",") {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if p == "" {
+				continue
+			}
+			if p == "*" {
+				result = append(result, hostPattern{all: true})
+				continue
+			}
+			if _, network, err := net.ParseCIDR(p); err == nil {
+				result = append(result, hostPattern{network: network})
+				continue
+			}
+			var h hostPattern
+			host := p
+			if hostPart, port, err := net.SplitHostPort(p); err == nil {
+				host, h.port = hostPart, port
+			}
+			host = strings.Trim(host, "[]")
+			if ip := net.ParseIP(host); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				h.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+				result = append(result, h)
+				continue
+			}
+			switch {
+			case strings.HasPrefix(host, "*."):
+				h.domain, h.subdomainsOnly = host[1:], true
+			case strings.HasPrefix(host, "."):
+				h.domain, h.subdomainsOnly = host, true
+			default:
+				h.domain = "." + host
+			}
+			if h.domain == "." || strings.ContainsAny(h.domain, "*/") {
+				return nil, fmt.Errorf("invalid host pattern %q", p)
+			}
+			result = append(result, h)
+		}
+	}
+	return result, nil
+}
+
+func matchHostPatterns(patterns []hostPattern, host, port string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, p := range patterns {
+		switch {
+		case p.all:
+			return true
+		case p.port != "" && p.port != port:
+			continue
+		case p.network != nil:
+			if ip != nil && p.network.Contains(ip) {
+				return true
+			}
+		case ip == nil:
+			// the domain is kept with its leading dot, .example.com
+			if strings.HasSuffix(host, p.domain) || (!p.subdomainsOnly && "."+host == p.domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,426 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	proxy, err := NewProxyFunc(ProxyOptions{
+		Rules: []ProxyRule{
+			{Hosts: []string{"internal.example.com:8080"}, Proxy: "http://10.0.0.3:3128"},
+			{Hosts: []string{"*.example.com", "10.1.0.0/16"}, Proxy: "socks5://10.0.0.1:1080"},
+			{Hosts: []string{"example.org,[::1]"}, Proxy: "http://user@10.0.0.2:3128", Username: "u", Password: "p"},
+		},
+		NoProxy: []string{"direct.example.com", "10.1.2.3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://api.example.com/v1", want: "socks5://10.0.0.1:1080"},
+		{url: "http://example.com/v1", want: ""},
+		{url: "http://API.Example.COM/v1", want: "socks5://10.0.0.1:1080"},
+		{url: "http://internal.example.com:8080/v1", want: "http://10.0.0.3:3128"},
+		{url: "http://internal.example.com/v1", want: "socks5://10.0.0.1:1080"},
+		{url: "http://direct.example.com/v1", want: ""},
+		{url: "http://a.direct.example.com/v1", want: ""},
+		{url: "http://10.1.0.1/v1", want: "socks5://10.0.0.1:1080"},
+		{url: "http://10.1.2.3/v1", want: ""},
+		{url: "http://example.org/v1", want: "http://u:p@10.0.0.2:3128"},
+		{url: "http://www.example.org/v1", want: "http://u:p@10.0.0.2:3128"},
+		{url: "http://[::1]:80/v1", want: "http://u:p@10.0.0.2:3128"},
+		{url: "http://other.net/v1", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			got, err := proxy(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+				t.Errorf("proxy %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyFuncInvalid(t *testing.T) {
+	tests := []ProxyOptions{
+		{Rules: []ProxyRule{{Hosts: []string{"*"}, Proxy: "ftp://10.0.0.1:21"}}},
+		{Rules: []ProxyRule{{Hosts: []string{"a*.example.com"}, Proxy: "http://10.0.0.1:3128"}}},
+		{NoProxy: []string{"."}},
+	}
+	for _, opts := range tests {
+		if _, err := NewProxyFunc(opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
+
+// proxyAuth returns the credentials of a Proxy-Authorization header
+func proxyAuth(header string) string {
+	if !strings.HasPrefix(header, "Basic ") {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// newHTTPProxy returns a stand-in of an http proxy, which forwards every request to target
+func newHTTPProxy(t *testing.T, target *httptest.Server) (*httptest.Server, *[]string) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	targetURL, _ := url.Parse(target.URL)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.Host+" "+proxyAuth(r.Header.Get("Proxy-Authorization")))
+		mu.Unlock()
+		if r.Header.Get("Proxy-Authorization") == "" {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		if r.Method != http.MethodConnect {
+			// a plain request is sent with its absolute URL
+			r.URL.Scheme, r.URL.Host = targetURL.Scheme, targetURL.Host
+			r.RequestURI = ""
+			r.Header.Del("Proxy-Authorization")
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+			_, _ = io.Copy(w, resp.Body)
+			return
+		}
+		upstream, err := net.Dial("tcp", targetURL.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go pipe(upstream, conn, rw.Reader)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, &requests
+}
+
+// pipe copies between the client and upstream connections until one of them is closed
+func pipe(upstream, client net.Conn, buffered io.Reader) {
+	defer upstream.Close()
+	defer client.Close()
+	go func() {
+		_, _ = io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+}
+
+func echoServer(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(r.Host + r.URL.Path))
+}
+
+func getThroughProxy(t *testing.T, proxy func(*http.Request) (*url.URL, error), config *tls.Config,
+	endpoint string) (string, error) {
+	transport := NewHTTPTransport(WithProxy(proxy), WithTLSConfig(config))
+	defer transport.CloseIdleConnections()
+	resp, err := DefaultTransport.WithClient(transport).Method(http.MethodGet).Endpoints(endpoint).
+		Resource("books").(*restfulClient).send(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func TestHTTPProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(echoServer))
+	defer target.Close()
+	proxyServer, requests := newHTTPProxy(t, target)
+
+	tests := []struct {
+		name     string
+		rule     ProxyRule
+		wantErr  bool
+		wantAuth string
+	}{
+		{name: "authenticated", rule: ProxyRule{Proxy: proxyServer.URL, Username: "u", Password: "p"}, wantAuth: "u:p"},
+		{name: "user info", rule: ProxyRule{Proxy: "http://v:q@" + proxyServer.Listener.Addr().String()}, wantAuth: "v:q"},
+		{name: "unauthenticated", rule: ProxyRule{Proxy: proxyServer.URL}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*requests = nil
+			tt.rule.Hosts = []string{"books.example.com"}
+			proxy, err := NewProxyFunc(ProxyOptions{Rules: []ProxyRule{tt.rule}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := getThroughProxy(t, proxy, nil, "http://books.example.com/v1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if len(*requests) != 1 || (*requests)[0] != "GET books.example.com "+tt.wantAuth {
+				t.Errorf("proxy requests %q", *requests)
+			}
+			if !tt.wantErr && body != "books.example.com/v1/books" {
+				t.Errorf("body %q", body)
+			}
+		})
+	}
+}
+
+func TestHTTPProxyConnect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(echoServer))
+	defer target.Close()
+	proxyServer, requests := newHTTPProxy(t, target)
+	roots := x509.NewCertPool()
+	roots.AddCert(target.Certificate())
+
+	proxy, err := NewProxyFunc(ProxyOptions{
+		Rules: []ProxyRule{{Hosts: []string{"example.com"}, Proxy: proxyServer.URL, Username: "u", Password: "p"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the certificate of the test server is for example.com
+	body, err := getThroughProxy(t, proxy, &tls.Config{RootCAs: roots}, "https://example.com/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "example.com/v1/books" {
+		t.Errorf("body %q", body)
+	}
+	if len(*requests) != 1 || (*requests)[0] != "CONNECT example.com:443 u:p" {
+		t.Errorf("proxy requests %q", *requests)
+	}
+}
+
+// socks5Proxy is a stand-in of a socks5 proxy with username and password, which connects every
+// request to target
+type socks5Proxy struct {
+	listener net.Listener
+	target   string
+	username string
+	password string
+
+	mu      sync.Mutex
+	connect []string
+}
+
+func newSOCKS5Proxy(t *testing.T, target, username, password string) *socks5Proxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &socks5Proxy{listener: listener, target: target, username: username, password: password}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return p
+}
+
+func (p *socks5Proxy) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	fail := func() {
+		conn.Close()
+	}
+	// greeting: version, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil || header[0] != 5 {
+		fail()
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		fail()
+		return
+	}
+	if !containsByte(methods, 2) {
+		_, _ = conn.Write([]byte{5, 0xff})
+		fail()
+		return
+	}
+	_, _ = conn.Write([]byte{5, 2})
+	// username and password of RFC 1929
+	username, password, err := readSOCKS5Auth(r)
+	if err != nil || username != p.username || password != p.password {
+		_, _ = conn.Write([]byte{1, 1})
+		fail()
+		return
+	}
+	_, _ = conn.Write([]byte{1, 0})
+	// request: version, command, reserved, address type
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil || request[1] != 1 {
+		fail()
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			fail()
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n, err := r.ReadByte()
+		if err != nil {
+			fail()
+			return
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			fail()
+			return
+		}
+		host = string(name)
+	default:
+		fail()
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		fail()
+		return
+	}
+	p.mu.Lock()
+	p.connect = append(p.connect, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	p.mu.Unlock()
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		fail()
+		return
+	}
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	pipe(upstream, conn, r)
+}
+
+func readSOCKS5Auth(r *bufio.Reader) (string, string, error) {
+	if version, err := r.ReadByte(); err != nil || version != 1 {
+		return "", "", errors.New("invalid auth version")
+	}
+	var values [2]string
+	for i := range values {
+		n, err := r.ReadByte()
+		if err != nil {
+			return "", "", err
+		}
+		value := make([]byte, n)
+		if _, err = io.ReadFull(r, value); err != nil {
+			return "", "", err
+		}
+		values[i] = string(value)
+	}
+	return values[0], values[1], nil
+}
+
+func containsByte(values []byte, value byte) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(echoServer))
+	defer target.Close()
+	socks := newSOCKS5Proxy(t, target.Listener.Addr().String(), "u", "p")
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "authenticated", password: "p"},
+		{name: "wrong password", password: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := NewProxyFunc(ProxyOptions{Rules: []ProxyRule{{
+				Hosts:    []string{"*.example.com"},
+				Proxy:    "socks5://" + socks.listener.Addr().String(),
+				Username: "u",
+				Password: tt.password,
+			}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := getThroughProxy(t, proxy, nil, "http://books.example.com/v1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && body != "books.example.com/v1/books" {
+				t.Errorf("body %q", body)
+			}
+		})
+	}
+	socks.mu.Lock()
+	defer socks.mu.Unlock()
+	if len(socks.connect) != 1 || socks.connect[0] != "books.example.com:80" {
+		t.Errorf("socks5 connects %q", socks.connect)
+	}
+}
+
+func TestProxyNotUsedForUnixSocket(t *testing.T) {
+	proxy, err := NewProxyFunc(ProxyOptions{Rules: []ProxyRule{{Hosts: []string{"*"}, Proxy: "http://10.0.0.1:3128"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := NewHTTPTransport(WithProxy(proxy))
+	u, _ := parseEndpoint("unix:///var/run/app.sock/v1")
+	if got, err := transport.Proxy(&http.Request{URL: u}); err != nil || got != nil {
+		t.Errorf("proxy %v, %v for a unix socket", got, err)
+	}
+	u, _ = url.Parse("http://books.example.com/v1")
+	if got, _ := transport.Proxy(&http.Request{URL: u}); got == nil {
+		t.Error("no proxy for a tcp host")
+	}
+}
@@ -0,0 +1,459 @@
+package rest
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/schema"
+)
+
+// Encoder encodes a value into query parameters, *schema.Encoder also satisfies it
+type Encoder interface {
+	Encode(src interface{}, dst map[string][]string) error
+}
+
+// newSchemaEncoder returns the default encoder of Querys reading the form tag,
+// time.Time and time.Duration are encoded like QueryEncoder does without option
+func newSchemaEncoder() *schema.Encoder {
+	e := schema.NewEncoder()
+	e.SetAliasTag("form")
+	e.RegisterEncoder(time.Time{}, func(v reflect.Value) string {
+		return formatTime(v.Interface().(time.Time), "")
+	})
+	e.RegisterEncoder(time.Duration(0), func(v reflect.Value) string {
+		return formatDuration(time.Duration(v.Int()), "")
+	})
+	return e
+}
+
+// defaultQueryEncoder encodes for Querys the values which *schema.Encoder can't encode
+var defaultQueryEncoder = NewQueryEncoder()
+
+// queryEncoderTypes caches whether the values of a type are encoded by defaultQueryEncoder
+var queryEncoderTypes sync.Map
+
+// queryEncoderFor returns the encoder of value for Querys without Encoder, schemaEncoder encodes value
+// unless its type has a field with a format or style option, a pointer to time.Time, a map, or a type
+// implementing encoding.TextMarshaler or fmt.Stringer, which only QueryEncoder encodes
+func queryEncoderFor(schemaEncoder *schema.Encoder, value interface{}) Encoder {
+	t := reflect.TypeOf(value)
+	need, ok := queryEncoderTypes.Load(t)
+	if !ok {
+		need = needsQueryEncoder(t, true, make(map[reflect.Type]bool))
+		queryEncoderTypes.Store(t, need)
+	}
+	if need.(bool) {
+		return defaultQueryEncoder
+	}
+	return schemaEncoder
+}
+
+func needsQueryEncoder(t reflect.Type, top bool, seen map[reflect.Type]bool) bool {
+	pointer := false
+	for t.Kind() == reflect.Ptr {
+		t, pointer = t.Elem(), true
+	}
+	switch t {
+	case timeType:
+		// schema encodes the fields of a pointer to a struct
+		return pointer
+	case durationType:
+		return false
+	}
+	if !top && (t.Implements(textMarshalerType) || t.Implements(stringerType) ||
+		reflect.PtrTo(t).Implements(textMarshalerType) || reflect.PtrTo(t).Implements(stringerType)) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array:
+		return needsQueryEncoder(t.Elem(), false, seen)
+	case reflect.Struct:
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get(defaultQueryEncoder.tag)
+			if field.PkgPath != "" || tag == "-" {
+				continue
+			}
+			for _, option := range strings.Split(tag, ",")[1:] {
+				if option != "omitempty" && option != "" {
+					return true
+				}
+			}
+			if needsQueryEncoder(field.Type, false, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// QueryStyle describes how arrays and nested objects are serialized into the query string
+type QueryStyle string
+
+const (
+	// StyleForm repeats the key for every item, ids=1&ids=2, nested fields are joined by dot, filter.name=x
+	StyleForm QueryStyle = "form"
+	// StyleComma joins the items by comma, ids=1,2
+	StyleComma QueryStyle = "comma"
+	// StyleBrackets appends brackets to the key of every item, ids[]=1&ids[]=2
+	StyleBrackets QueryStyle = "brackets"
+	// StyleDeepObject is the OpenAPI deepObject style, filter[name]=x
+	StyleDeepObject QueryStyle = "deepObject"
+	// StyleSpaceDelimited joins the items by space, ids=1%202
+	StyleSpaceDelimited QueryStyle = "spaceDelimited"
+	// StylePipeDelimited joins the items by pipe, ids=1|2
+	StylePipeDelimited QueryStyle = "pipeDelimited"
+)
+
+// QueryEncoder encodes structs and maps into query parameters, it is an alternative to
+// the default *schema.Encoder, set by RESTClient.Encoder or the WithEncoder option of a transport.
+// Without them, Querys encodes by a QueryEncoder the values which *schema.Encoder can't encode.
+// The name and options of a field are read from the struct tag,
+// e.g. `form:"ids,omitempty,style=comma"` or `form:"since,unix"`.
+//
+// time.Time is encoded as RFC3339 unless one of the options rfc3339nano, date, unix, unixmilli
+// or unixnano is given, time.Duration is encoded by its String method unless one of the options
+// seconds or millis is given, other types implementing encoding.TextMarshaler or fmt.Stringer
+// are encoded by them. Encode returns an error for an unknown option.
+type QueryEncoder struct {
+	tag      string
+	style    QueryStyle
+	encoders map[reflect.Type]func(reflect.Value) string
+}
+
+// NewQueryEncoder returns a QueryEncoder reading the form tag with StyleForm as default style
+func NewQueryEncoder() *QueryEncoder {
+	return &QueryEncoder{
+		tag:      "form",
+		style:    StyleForm,
+		encoders: make(map[reflect.Type]func(reflect.Value) string),
+	}
+}
+
+// RegisterEncoder registers a function encoding values of the type of value,
+// it takes precedence over the built-in encoders
+func (e *QueryEncoder) RegisterEncoder(value interface{}, encoder func(reflect.Value) string) *QueryEncoder {
+	e.encoders[reflect.TypeOf(value)] = encoder
+	return e
+}
+
+// SetAliasTag changes the tag used to read the name and options of a field
+func (e *QueryEncoder) SetAliasTag(tag string) *QueryEncoder {
+	e.tag = tag
+	return e
+}
+
+// SetStyle changes the style of fields without a style option
+func (e *QueryEncoder) SetStyle(style QueryStyle) *QueryEncoder {
+	e.style = style
+	return e
+}
+
+func (e *QueryEncoder) Encode(src interface{}, dst map[string][]string) error {
+	v := reflect.ValueOf(src)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	opts := fieldOptions{style: e.style}
+	switch v.Kind() {
+	case reflect.Struct:
+		return e.encodeStruct(v, "", opts, dst)
+	case reflect.Map:
+		return e.encodeMap(v, "", opts, dst)
+	default:
+		return fmt.Errorf("rest: can't encode %s into query parameters", v.Type())
+	}
+}
+
+type fieldOptions struct {
+	name      string
+	omitEmpty bool
+	style     QueryStyle
+	format    string
+}
+
+func (e *QueryEncoder) fieldOptions(field reflect.StructField, style QueryStyle) (fieldOptions, error) {
+	opts := fieldOptions{name: field.Name, style: style}
+	tag, ok := field.Tag.Lookup(e.tag)
+	if !ok {
+		return opts, nil
+	}
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		opts.name = parts[0]
+	}
+	for _, option := range parts[1:] {
+		switch {
+		case option == "omitempty":
+			opts.omitEmpty = true
+		case strings.HasPrefix(option, "style="):
+			s, err := parseQueryStyle(strings.TrimPrefix(option, "style="))
+			if err != nil {
+				return opts, fmt.Errorf("rest: field %s: %w", field.Name, err)
+			}
+			opts.style = s
+		case timeFormats[option] || durationFormats[option]:
+			opts.format = option
+		case option != "":
+			return opts, fmt.Errorf("rest: field %s: unknown option %q", field.Name, option)
+		}
+	}
+	return opts, nil
+}
+
+var (
+	timeFormats     = map[string]bool{"rfc3339": true, "rfc3339nano": true, "date": true, "unix": true, "unixmilli": true, "unixnano": true}
+	durationFormats = map[string]bool{"seconds": true, "millis": true}
+)
+
+func parseQueryStyle(s string) (QueryStyle, error) {
+	switch style := QueryStyle(s); style {
+	case StyleForm, StyleComma, StyleBrackets, StyleDeepObject, StyleSpaceDelimited, StylePipeDelimited:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown query style %q", s)
+}
+
+func (e *QueryEncoder) encodeStruct(v reflect.Value, prefix string, parent fieldOptions, dst map[string][]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if field.Tag.Get(e.tag) == "-" {
+			continue
+		}
+		opts, err := e.fieldOptions(field, parent.style)
+		if err != nil {
+			return err
+		}
+		fv := v.Field(i)
+		if opts.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if _, tagged := field.Tag.Lookup(e.tag); field.Anonymous && !tagged {
+			// embedded structs without tag are flattened into the parent
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err = e.encodeStruct(fv, prefix, opts, dst); err != nil {
+					return err
+				}
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+		}
+		if err = e.encodeValue(fv, nestedKey(prefix, opts.name, parent.style), opts, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *QueryEncoder) encodeMap(v reflect.Value, prefix string, opts fieldOptions, dst map[string][]string) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("rest: can't encode map with %s key into query parameters", v.Type().Key())
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, key := range keys {
+		if err := e.encodeValue(v.MapIndex(key), nestedKey(prefix, key.String(), opts.style), opts, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *QueryEncoder) encodeValue(v reflect.Value, key string, opts fieldOptions, dst map[string][]string) error {
+	if s, ok, err := e.format(v, opts.format); err != nil || ok {
+		if ok {
+			dst[key] = append(dst[key], s)
+		}
+		return err
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return e.encodeStruct(v, key, opts, dst)
+	case reflect.Map:
+		return e.encodeMap(v, key, opts, dst)
+	case reflect.Slice, reflect.Array:
+		return e.encodeSlice(v, key, opts, dst)
+	default:
+		return fmt.Errorf("rest: can't encode %s of %q into query parameters", v.Type(), key)
+	}
+}
+
+func (e *QueryEncoder) encodeSlice(v reflect.Value, key string, opts fieldOptions, dst map[string][]string) error {
+	items := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		s, ok, err := e.format(item, opts.format)
+		if err != nil {
+			return err
+		}
+		if ok {
+			items = append(items, s)
+			continue
+		}
+		// items of objects are addressed by their index
+		if err = e.encodeValue(item, nestedKey(key, strconv.Itoa(i), opts.style), opts, dst); err != nil {
+			return err
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	switch opts.style {
+	case StyleComma:
+		dst[key] = append(dst[key], strings.Join(items, ","))
+	case StyleSpaceDelimited:
+		dst[key] = append(dst[key], strings.Join(items, " "))
+	case StylePipeDelimited:
+		dst[key] = append(dst[key], strings.Join(items, "|"))
+	case StyleBrackets, StyleDeepObject:
+		dst[key+"[]"] = append(dst[key+"[]"], items...)
+	default:
+		dst[key] = append(dst[key], items...)
+	}
+	return nil
+}
+
+func nestedKey(prefix, name string, style QueryStyle) string {
+	if prefix == "" {
+		return name
+	}
+	if style == StyleDeepObject || style == StyleBrackets {
+		return prefix + "[" + name + "]"
+	}
+	return prefix + "." + name
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// format encodes v as a single query value, ok is false if v is not a scalar
+func (e *QueryEncoder) format(v reflect.Value, format string) (s string, ok bool, err error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if encoder, found := e.encoders[v.Type()]; found && !v.IsNil() {
+			return encoder(v), true, nil
+		}
+		if v.IsNil() {
+			return "", false, nil
+		}
+		v = v.Elem()
+	}
+	if encoder, found := e.encoders[v.Type()]; found {
+		return encoder(v), true, nil
+	}
+	switch v.Type() {
+	case timeType:
+		if format != "" && !timeFormats[format] {
+			return "", false, fmt.Errorf("rest: option %q doesn't apply to %s", format, v.Type())
+		}
+		return formatTime(v.Interface().(time.Time), format), true, nil
+	case durationType:
+		if format != "" && !durationFormats[format] {
+			return "", false, fmt.Errorf("rest: option %q doesn't apply to %s", format, v.Type())
+		}
+		return formatDuration(time.Duration(v.Int()), format), true, nil
+	}
+	if format != "" {
+		// the options of time.Time and time.Duration don't apply to other scalars
+		if _, ok, _ := e.format(v, ""); ok {
+			return "", false, fmt.Errorf("rest: option %q doesn't apply to %s", format, v.Type())
+		}
+		return "", false, nil
+	}
+	if v.CanInterface() {
+		// methods with pointer receiver are only reachable through an addressable value
+		value := v.Interface()
+		if v.CanAddr() {
+			value = v.Addr().Interface()
+		}
+		switch t := value.(type) {
+		case encoding.TextMarshaler:
+			text, err := t.MarshalText()
+			if err != nil {
+				return "", false, err
+			}
+			return string(text), true, nil
+		case fmt.Stringer:
+			return t.String(), true, nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), true, nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true, nil
+	}
+	return "", false, nil
+}
+
+func formatTime(t time.Time, format string) string {
+	switch format {
+	case "rfc3339nano":
+		return t.Format(time.RFC3339Nano)
+	case "date":
+		return t.Format("2006-01-02")
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	case "unixnano":
+		return strconv.FormatInt(t.UnixNano(), 10)
+	default:
+		return t.Format(time.RFC3339)
+	}
+}
+
+func formatDuration(d time.Duration, format string) string {
+	switch format {
+	case "seconds":
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	case "millis":
+		return strconv.FormatInt(d.Milliseconds(), 10)
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,340 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type queryFilter struct {
+	Name string `form:"name"`
+	Tags []int  `form:"tags"`
+}
+
+func TestQueryEncoderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   QueryStyle
+		value   interface{}
+		wantRaw string
+		want    url.Values
+	}{
+		{
+			name: "form",
+			value: struct {
+				IDs    []int       `form:"ids"`
+				Filter queryFilter `form:"filter"`
+			}{IDs: []int{1, 2}, Filter: queryFilter{Name: "x", Tags: []int{3}}},
+			wantRaw: "filter.name=x&filter.tags=3&ids=1&ids=2",
+			want:    url.Values{"ids": {"1", "2"}, "filter.name": {"x"}, "filter.tags": {"3"}},
+		},
+		{
+			name: "comma",
+			value: struct {
+				IDs []string `form:"ids,style=comma"`
+			}{IDs: []string{"a", "b,c"}},
+			wantRaw: "ids=a%2Cb%2Cc",
+			want:    url.Values{"ids": {"a,b,c"}},
+		},
+		{
+			name: "brackets",
+			value: struct {
+				IDs []int `form:"ids,style=brackets"`
+			}{IDs: []int{1, 2}},
+			wantRaw: "ids%5B%5D=1&ids%5B%5D=2",
+			want:    url.Values{"ids[]": {"1", "2"}},
+		},
+		{
+			name: "deepObject",
+			value: struct {
+				Filter queryFilter `form:"filter,style=deepObject"`
+			}{Filter: queryFilter{Name: "x", Tags: []int{1, 2}}},
+			wantRaw: "filter%5Bname%5D=x&filter%5Btags%5D%5B%5D=1&filter%5Btags%5D%5B%5D=2",
+			want:    url.Values{"filter[name]": {"x"}, "filter[tags][]": {"1", "2"}},
+		},
+		{
+			name: "spaceDelimited",
+			value: struct {
+				IDs []int `form:"ids,style=spaceDelimited"`
+			}{IDs: []int{1, 2}},
+			wantRaw: "ids=1+2",
+			want:    url.Values{"ids": {"1 2"}},
+		},
+		{
+			name: "pipeDelimited",
+			value: struct {
+				IDs []int `form:"ids,style=pipeDelimited"`
+			}{IDs: []int{1, 2}},
+			wantRaw: "ids=1%7C2",
+			want:    url.Values{"ids": {"1|2"}},
+		},
+		{
+			name:  "client-wide style",
+			style: StyleComma,
+			value: struct {
+				IDs  []int `form:"ids"`
+				Tags []int `form:"tags,style=form"`
+			}{IDs: []int{1, 2}, Tags: []int{3, 4}},
+			wantRaw: "ids=1%2C2&tags=3&tags=4",
+			want:    url.Values{"ids": {"1,2"}, "tags": {"3", "4"}},
+		},
+		{
+			name: "omitempty",
+			value: struct {
+				IDs   []int  `form:"ids,omitempty,style=comma"`
+				Name  string `form:"name,omitempty"`
+				Limit int    `form:"limit"`
+			}{},
+			wantRaw: "limit=0",
+			want:    url.Values{"limit": {"0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := NewQueryEncoder()
+			if tt.style != "" {
+				encoder.SetStyle(tt.style)
+			}
+			dst := make(url.Values)
+			if err := encoder.Encode(tt.value, dst); err != nil {
+				t.Fatal(err)
+			}
+			raw := dst.Encode()
+			if raw != tt.wantRaw {
+				t.Errorf("encoded %q, want %q", raw, tt.wantRaw)
+			}
+			parsed, err := url.ParseQuery(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, tt.want) {
+				t.Errorf("parsed %v, want %v", parsed, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryEncoderUnknownStyle(t *testing.T) {
+	value := struct {
+		IDs []int `form:"ids,style=matrix"`
+	}{IDs: []int{1}}
+	if err := NewQueryEncoder().Encode(value, make(url.Values)); err == nil {
+		t.Fatal("expected an error for an unknown style")
+	}
+}
+
+func TestQuerysEncoder(t *testing.T) {
+	var got url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+	}))
+	defer server.Close()
+
+	type opts struct {
+		Offset int   `form:"offset"`
+		IDs    []int `form:"ids,style=comma"`
+	}
+	tests := []struct {
+		name   string
+		client RESTClient
+		want   url.Values
+	}{
+		{
+			// the style option is encoded by a QueryEncoder without Encoder
+			name:   "default",
+			client: Get(),
+			want:   url.Values{"offset": {"1"}, "ids": {"1,2"}},
+		},
+		{
+			name:   "opt-in on the client",
+			client: Get().Encoder(NewQueryEncoder()),
+			want:   url.Values{"offset": {"1"}, "ids": {"1,2"}},
+		},
+		{
+			name:   "opt-in on the transport",
+			client: ConfigureTransport(DefaultTransport, WithEncoder(NewQueryEncoder())).Method(http.MethodGet),
+			want:   url.Values{"offset": {"1"}, "ids": {"1,2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.client.Endpoints(server.URL).Querys(opts{Offset: 1, IDs: []int{1, 2}}).
+				DoNop(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type queryLevel int
+
+func (l queryLevel) String() string {
+	return [...]string{"low", "high"}[l]
+}
+
+type queryID struct {
+	n int
+}
+
+func (id *queryID) MarshalText() ([]byte, error) {
+	return []byte("id-" + strconv.Itoa(id.n)), nil
+}
+
+func TestQueryEncoderTypes(t *testing.T) {
+	at := time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC)
+	value := struct {
+		Default  time.Time      `form:"default"`
+		Nano     time.Time      `form:"nano,rfc3339nano"`
+		Date     time.Time      `form:"date,date"`
+		Unix     time.Time      `form:"unix,unix"`
+		Milli    *time.Time     `form:"milli,unixmilli"`
+		Times    []time.Time    `form:"times,unix,style=comma"`
+		Timeout  time.Duration  `form:"timeout"`
+		Seconds  time.Duration  `form:"seconds,seconds"`
+		Millis   time.Duration  `form:"millis,millis"`
+		Level    queryLevel     `form:"level"`
+		ID       queryID        `form:"id"`
+		Optional *int           `form:"optional"`
+		Levels   map[string]int `form:"levels,style=deepObject"`
+	}{
+		Default: at, Nano: at, Date: at, Unix: at, Milli: &at, Times: []time.Time{at, at.Add(time.Second)},
+		Timeout: 1500 * time.Millisecond, Seconds: 1500 * time.Millisecond, Millis: 1500 * time.Millisecond,
+		Level: 1, ID: queryID{n: 7}, Levels: map[string]int{"a": 1},
+	}
+	want := url.Values{
+		"default":   {"2023-04-05T06:07:08Z"},
+		"nano":      {"2023-04-05T06:07:08.000000009Z"},
+		"date":      {"2023-04-05"},
+		"unix":      {"1680674828"},
+		"milli":     {"1680674828000"},
+		"times":     {"1680674828,1680674829"},
+		"timeout":   {"1.5s"},
+		"seconds":   {"1.5"},
+		"millis":    {"1500"},
+		"level":     {"high"},
+		"id":        {"id-7"},
+		"levels[a]": {"1"},
+	}
+	dst := make(url.Values)
+	if err := NewQueryEncoder().Encode(&value, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("encoded %v, want %v", dst, want)
+	}
+}
+
+func TestQueryEncoderInvalidOption(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{
+			name: "typo",
+			value: struct {
+				Since time.Time `form:"since,unixmili"`
+			}{},
+		},
+		{
+			name: "time option on a duration",
+			value: struct {
+				Timeout time.Duration `form:"timeout,unix"`
+			}{},
+		},
+		{
+			name: "duration option on a time",
+			value: struct {
+				Since time.Time `form:"since,seconds"`
+			}{},
+		},
+		{
+			name: "time option on an int",
+			value: struct {
+				IDs []int `form:"ids,unix"`
+			}{IDs: []int{1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewQueryEncoder().Encode(tt.value, make(url.Values)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestQuerysDefaultEncoderTypes(t *testing.T) {
+	at := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  url.Values
+	}{
+		{
+			name: "schema",
+			value: struct {
+				Since   time.Time     `form:"since"`
+				Timeout time.Duration `form:"timeout"`
+				Tags    []string      `form:"tags,omitempty"`
+			}{Since: time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC), Timeout: time.Second},
+			want: url.Values{"since": {"2023-04-05T06:07:08Z"}, "timeout": {"1s"}},
+		},
+		{
+			name: "format options, stringers and pointers",
+			value: struct {
+				Since time.Time  `form:"since,unix"`
+				Level queryLevel `form:"level"`
+				At    *time.Time `form:"at"`
+				Until *time.Time `form:"until"`
+			}{Since: at, Level: 1, At: &at},
+			want: url.Values{"since": {"1700000000"}, "level": {"high"}, "at": {"2023-11-14T22:13:20Z"}},
+		},
+		{
+			name: "text marshaler",
+			value: &struct {
+				ID queryID `form:"id"`
+			}{ID: queryID{n: 7}},
+			want: url.Values{"id": {"id-7"}},
+		},
+		{
+			name: "nested",
+			value: struct {
+				Filter struct {
+					Levels []queryLevel `form:"levels"`
+				} `form:"filter"`
+			}{Filter: struct {
+				Levels []queryLevel `form:"levels"`
+			}{Levels: []queryLevel{0, 1}}},
+			want: url.Values{"filter.levels": {"low", "high"}},
+		},
+		{
+			name:  "map",
+			value: map[string]int{"offset": 1},
+			want:  url.Values{"offset": {"1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				got = req.URL.Query()
+			}))
+			defer server.Close()
+			if err := Get().Endpoints(server.URL).Querys(tt.value).DoNop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
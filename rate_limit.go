@@ -0,0 +1,281 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by NewRateLimitRoundTripper for the requests it never sends, as its rate is 0
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// minBucketSweep is the number of buckets above which the idle buckets are evicted
+const minBucketSweep = 64
+
+// RateLimitOption configures the limiter of NewRateLimitRoundTripper
+type RateLimitOption func(*rateLimitRoundTripper)
+
+// WithRateLimitKey sets the function selecting the bucket of a request, RateLimitByHost by default
+func WithRateLimitKey(key func(*http.Request) string) RateLimitOption {
+	return func(r *rateLimitRoundTripper) {
+		r.key = key
+	}
+}
+
+// WithAdaptiveRateLimit makes the limiter follow the X-RateLimit-Remaining and X-RateLimit-Reset
+// headers of the responses, and the Retry-After header of the 429 responses
+func WithAdaptiveRateLimit() RateLimitOption {
+	return func(r *rateLimitRoundTripper) {
+		r.adaptive = true
+	}
+}
+
+// RateLimitByHost limits the requests per host
+func RateLimitByHost(req *http.Request) string {
+	return req.URL.Host
+}
+
+// RateLimitByResource limits the requests per resource, like /v1/books, and per host
+// for the requests without resource
+func RateLimitByResource(req *http.Request) string {
+	return req.URL.Host + resourceFrom(req.Context())
+}
+
+// NewRateLimitRoundTripper returns a RoundTripper sending at most r requests per second to roundTripper
+// with bursts of burst requests, a request waits for its turn until its context is done.
+// The time waited is added to the Metadata of the request. The buckets refilled to burst
+// are evicted as the number of keys grows, they are created again on demand. e.g.
+//
+//	handler := rest.NewHandler(rest.WithTransport(rest.DefaultTransport.WithClient(
+//		rest.NewRateLimitRoundTripper(http.DefaultTransport, 10, 20, rest.WithRateLimitKey(rest.RateLimitByResource)))))
+func NewRateLimitRoundTripper(roundTripper http.RoundTripper, r float64, burst int,
+	opts ...RateLimitOption) http.RoundTripper {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := &rateLimitRoundTripper{
+		next:    roundTripper,
+		rate:    r,
+		burst:   burst,
+		key:     RateLimitByHost,
+		buckets: make(map[string]*tokenBucket),
+		sweepAt: minBucketSweep,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(limiter)
+	}
+	return limiter
+}
+
+type rateLimitRoundTripper struct {
+	next     http.RoundTripper
+	rate     float64
+	burst    int
+	key      func(*http.Request) string
+	adaptive bool
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// sweepAt is the number of buckets evicting the idle ones
+	sweepAt int
+}
+
+func (l *rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	bucket := l.acquire(l.key(req))
+	defer l.release(bucket)
+	wait, err := bucket.wait(req.Context(), l.now)
+	if md := MetadataFrom(req.Context()); md != nil {
+		md.RateLimitWait += wait
+	}
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	resp, err := l.next.RoundTrip(req)
+	if err == nil && l.adaptive {
+		bucket.adapt(resp, l.now())
+	}
+	return resp, err
+}
+
+// acquire returns the bucket of key, which is not evicted until it is released
+func (l *rateLimitRoundTripper) acquire(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.sweepAt {
+			l.sweep()
+		}
+		bucket = &tokenBucket{rate: l.rate, burst: float64(l.burst), tokens: float64(l.burst), last: l.now()}
+		l.buckets[key] = bucket
+	}
+	bucket.users++
+	return bucket
+}
+
+func (l *rateLimitRoundTripper) release(bucket *tokenBucket) {
+	l.mu.Lock()
+	bucket.users--
+	l.mu.Unlock()
+}
+
+// sweep evicts the buckets which are not used, full and not paused, they are the same as new ones
+func (l *rateLimitRoundTripper) sweep() {
+	now := l.now()
+	for key, bucket := range l.buckets {
+		if bucket.users == 0 && bucket.idle(now) {
+			delete(l.buckets, key)
+		}
+	}
+	// the sweeps stay amortized when most of the buckets are busy
+	l.sweepAt = 2 * len(l.buckets)
+	if l.sweepAt < minBucketSweep {
+		l.sweepAt = minBucketSweep
+	}
+}
+
+// closeRequestBody closes the body of a request which is not sent, as a RoundTripper must
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+type tokenBucket struct {
+	// users is the number of requests holding the bucket, guarded by the mutex of the limiter
+	users int
+
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// pausedUntil is set by the server asking to stop sending
+	pausedUntil time.Time
+}
+
+// advance refills the bucket up to now
+func (b *tokenBucket) advance(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// idle tells whether the bucket is full and not paused at now
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	return b.tokens >= b.burst && !b.pausedUntil.After(now)
+}
+
+// wait takes a token, waiting until it is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context, now func() time.Time) (time.Duration, error) {
+	b.mu.Lock()
+	t := now()
+	b.advance(t)
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		if b.rate <= 0 {
+			b.tokens++
+			b.mu.Unlock()
+			return 0, fmt.Errorf("%w: %g requests per second", ErrRateLimited, b.rate)
+		}
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	if pause := b.pausedUntil.Sub(t); pause > wait {
+		wait = pause
+	}
+	b.mu.Unlock()
+	if wait <= 0 {
+		return 0, nil
+	}
+
+	cancel := func() {
+		// give back the token, unless it was refilled in the meantime
+		b.mu.Lock()
+		b.advance(now())
+		b.tokens = math.Min(b.burst, b.tokens+1)
+		b.mu.Unlock()
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(t) < wait {
+		cancel()
+		return 0, fmt.Errorf("rate limit wait %s exceeds the deadline: %w", wait, context.DeadlineExceeded)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		cancel()
+		return now().Sub(t), ctx.Err()
+	}
+}
+
+// adapt follows the rate limit headers of resp
+func (b *tokenBucket) adapt(resp *http.Response, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			b.pause(retryAfter)
+		}
+	}
+	remaining, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+	b.advance(now)
+	if remaining < b.tokens {
+		b.tokens = remaining
+	}
+	if remaining < 1 {
+		if reset, ok := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now); ok {
+			b.pause(reset)
+		}
+	}
+}
+
+func (b *tokenBucket) pause(until time.Time) {
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// parseRetryAfter parses Retry-After, which is either seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseRateLimitReset parses X-RateLimit-Reset, which is either seconds or a unix time
+func parseRateLimitReset(value string, now time.Time) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false
+	}
+	// seconds can't be a unix time before 2001
+	if seconds >= 1e9 {
+		return time.Unix(seconds, 0), true
+	}
+	return now.Add(time.Duration(seconds) * time.Second), true
+}
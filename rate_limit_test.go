@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func okRoundTripper() http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}, nil
+	})
+}
+
+func TestRateLimitZeroRate(t *testing.T) {
+	limiter := NewRateLimitRoundTripper(okRoundTripper(), 0, 1)
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:80/books", nil)
+	if _, err := limiter.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.RoundTrip(req); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("error %v, want ErrRateLimited", err)
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	limiter := NewRateLimitRoundTripper(okRoundTripper(), 100, 1)
+	var md Metadata
+	req, _ := http.NewRequestWithContext(WithMetadata(context.Background(), &md),
+		http.MethodGet, "http://localhost:80/books", nil)
+	for i := 0; i < 2; i++ {
+		if _, err := limiter.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if md.RateLimitWait <= 0 {
+		t.Errorf("waited %s", md.RateLimitWait)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	limiter = NewRateLimitRoundTripper(okRoundTripper(), 0.1, 1)
+	req = req.WithContext(ctx)
+	_, _ = limiter.RoundTrip(req)
+	if _, err := limiter.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestRateLimitEviction(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimitRoundTripper(okRoundTripper(), 1, 1,
+		WithRateLimitKey(func(req *http.Request) string { return req.URL.Query().Get("key") }),
+		WithAdaptiveRateLimit()).(*rateLimitRoundTripper)
+	limiter.now = func() time.Time { return now }
+	send := func(key string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost:80/books?key="+key, nil)
+		if _, err := limiter.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < minBucketSweep; i++ {
+		send(strconv.Itoa(i))
+	}
+	// a paused bucket is kept although its tokens are refilled
+	limiter.buckets["0"].pause(now.Add(time.Hour))
+
+	now = now.Add(time.Second)
+	send("new")
+	if got := len(limiter.buckets); got != 2 {
+		t.Fatalf("%d buckets after the sweep, want 2", got)
+	}
+	if _, ok := limiter.buckets["0"]; !ok {
+		t.Error("paused bucket evicted")
+	}
+	if limiter.sweepAt != minBucketSweep {
+		t.Errorf("next sweep at %d", limiter.sweepAt)
+	}
+}
+
+func TestRateLimitSweepKeepsUsedBuckets(t *testing.T) {
+	limiter := NewRateLimitRoundTripper(okRoundTripper(), 1, 1).(*rateLimitRoundTripper)
+	// a bucket acquired but not taken from yet is full, like the idle ones
+	used := limiter.acquire("used")
+	for i := 0; i < minBucketSweep; i++ {
+		limiter.release(limiter.acquire(strconv.Itoa(i)))
+	}
+	if got := limiter.buckets["used"]; got != used {
+		t.Fatal("used bucket evicted, its key would get a second burst")
+	}
+	if got := len(limiter.buckets); got != 2 {
+		t.Errorf("%d buckets after the sweep, want 2", got)
+	}
+
+	limiter.release(used)
+	limiter.sweep()
+	if _, ok := limiter.buckets["used"]; ok {
+		t.Error("released bucket kept")
+	}
+}
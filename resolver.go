@@ -0,0 +1,340 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Resolver resolves the endpoints given to RESTClient.Endpoints into the endpoints the requests
+// are sent to, it is called for every request. A name the resolver doesn't know is returned as is
+type Resolver interface {
+	Resolve(ctx context.Context, name string) ([]string, error)
+}
+
+// ChainResolver resolves the names with every resolver in turn
+func ChainResolver(resolvers ...Resolver) Resolver {
+	return chainResolver(resolvers)
+}
+
+type chainResolver []Resolver
+
+func (c chainResolver) Resolve(ctx context.Context, name string) ([]string, error) {
+	names := []string{name}
+	for _, resolver := range c {
+		var resolved []string
+		for _, name := range names {
+			endpoints, err := resolver.Resolve(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, endpoints...)
+		}
+		names = resolved
+	}
+	return names, nil
+}
+
+// dnsLookupTimeout bounds a lookup, which outlives the request starting it
+const dnsLookupTimeout = 10 * time.Second
+
+// DNSResolverOption configures the Resolver created by NewDNSResolver
+type DNSResolverOption func(*dnsResolver)
+
+// WithEndpointHealth sets the function telling whether an endpoint is healthy, e.g. HealthChecker.Healthy,
+// the targets of the next priority are resolved when none of a priority is healthy.
+// Without it, only the targets of the lowest priority are resolved
+func WithEndpointHealth(healthy func(endpoint string) bool) DNSResolverOption {
+	return func(d *dnsResolver) {
+		d.healthy = healthy
+	}
+}
+
+// NewDNSResolver returns a Resolver looking up the SRV records of the names like srv+http://_books._tcp.svc/v1,
+// which resolves into http://{target}:{port}/v1 for the records of the lowest priority, the backup targets
+// of the higher priorities are only resolved as set by WithEndpointHealth. The weights of the records are
+// ignored, the targets of a priority are balanced by the Balancer of the transport.
+// As net.Resolver doesn't expose the TTL of the records, they are cached for refresh. Once expired,
+// the cached endpoints are still returned while the records are looked up again in the background,
+// and kept if the lookup fails. The concurrent lookups of a name are shared
+func NewDNSResolver(refresh time.Duration, opts ...DNSResolverOption) Resolver {
+	d := &dnsResolver{
+		refresh: refresh,
+		lookup:  net.DefaultResolver.LookupSRV,
+		now:     time.Now,
+		entries: make(map[string]*dnsEntry),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+type dnsResolver struct {
+	refresh time.Duration
+	lookup  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	healthy func(endpoint string) bool
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	// priorities are the host:port of the targets by priority, the lowest first
+	priorities [][]string
+	expires    time.Time
+	// lookup is the lookup in flight, nil if there is none
+	lookup *dnsLookup
+}
+
+type dnsLookup struct {
+	done chan struct{}
+	err  error
+}
+
+func (d *dnsResolver) Resolve(ctx context.Context, name string) ([]string, error) {
+	scheme, rest, ok := strings.Cut(name, "://")
+	if !ok || !strings.HasPrefix(scheme, "srv+") {
+		return []string{name}, nil
+	}
+	host, p := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		host, p = rest[:i], rest[i:]
+	}
+	d.mu.Lock()
+	entry, ok := d.entries[host]
+	if !ok {
+		entry = &dnsEntry{}
+		d.entries[host] = entry
+	}
+	if entry.lookup == nil && !d.now().Before(entry.expires) {
+		entry.lookup = &dnsLookup{done: make(chan struct{})}
+		go d.update(ctx, host, entry, entry.lookup)
+	}
+	priorities, lookup := entry.priorities, entry.lookup
+	d.mu.Unlock()
+	if priorities == nil {
+		// nothing is resolved yet
+		select {
+		case <-lookup.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if lookup.err != nil {
+			return nil, lookup.err
+		}
+		d.mu.Lock()
+		priorities = entry.priorities
+		d.mu.Unlock()
+	}
+	scheme = strings.TrimPrefix(scheme, "srv+")
+	var first []string
+	for _, hostPorts := range priorities {
+		endpoints := make([]string, len(hostPorts))
+		healthy := false
+		for i, hostPort := range hostPorts {
+			endpoints[i] = scheme + "://" + hostPort + p
+			healthy = healthy || d.healthy == nil || d.healthy(endpoints[i])
+		}
+		if healthy {
+			return endpoints, nil
+		}
+		if first == nil {
+			first = endpoints
+		}
+	}
+	// none is healthy, the lowest priority is tried anyway
+	return first, nil
+}
+
+// update looks up the records of host into entry
+func (d *dnsResolver) update(ctx context.Context, host string, entry *dnsEntry, lookup *dnsLookup) {
+	ctx, cancel := context.WithTimeout(valueContext{ctx}, dnsLookupTimeout)
+	defer cancel()
+	_, records, err := d.lookup(ctx, "", "", host)
+	if err == nil && len(records) == 0 {
+		err = fmt.Errorf("no SRV record for %s", host)
+	}
+	var priorities [][]string
+	if err == nil {
+		// the records are grouped by priority, ordered by weight
+		sort.SliceStable(records, func(i, j int) bool {
+			if records[i].Priority != records[j].Priority {
+				return records[i].Priority < records[j].Priority
+			}
+			return records[i].Weight > records[j].Weight
+		})
+		for i, record := range records {
+			if i == 0 || record.Priority != records[i-1].Priority {
+				priorities = append(priorities, nil)
+			}
+			target := strings.TrimSuffix(record.Target, ".")
+			last := len(priorities) - 1
+			priorities[last] = append(priorities[last], net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+		}
+	}
+	d.mu.Lock()
+	if err == nil {
+		entry.priorities = priorities
+	}
+	if entry.priorities != nil {
+		// the stale endpoints are kept until the next refresh
+		entry.expires = d.now().Add(d.refresh)
+	}
+	entry.lookup = nil
+	lookup.err = err
+	d.mu.Unlock()
+	close(lookup.done)
+}
+
+// NewFileResolver returns a FileResolver reading the endpoints of the names from the JSON file path like
+// {"books": ["http://10.0.0.1:80", "http://10.0.0.2:80"]}, the file is watched and read again when it changes.
+// The last valid content is kept if the file becomes invalid or is removed
+func NewFileResolver(path string) (*FileResolver, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// the directory is watched, so that a file replaced by a rename or a symlink is followed
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	f := &FileResolver{path: path, watcher: watcher, done: make(chan struct{})}
+	f.reload()
+	go f.watch()
+	return f, nil
+}
+
+// FileResolver is the Resolver of NewFileResolver, it must be closed to stop watching the file
+type FileResolver struct {
+	path    string
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+
+	mu        sync.Mutex
+	modTime   time.Time
+	size      int64
+	endpoints map[string][]string
+	err       error
+}
+
+func (f *FileResolver) Resolve(_ context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.endpoints == nil && f.err != nil {
+		return nil, f.err
+	}
+	if endpoints, ok := f.endpoints[name]; ok {
+		return append([]string(nil), endpoints...), nil
+	}
+	return []string{name}, nil
+}
+
+// Close stops watching the file
+func (f *FileResolver) Close() error {
+	err := f.watcher.Close()
+	<-f.done
+	return err
+}
+
+func (f *FileResolver) watch() {
+	defer close(f.done)
+	for {
+		select {
+		case _, ok := <-f.watcher.Events:
+			if !ok {
+				return
+			}
+			f.reload()
+		case err, ok := <-f.watcher.Errors:
+			if !ok {
+				return
+			}
+			f.mu.Lock()
+			f.err = err
+			f.mu.Unlock()
+		}
+	}
+}
+
+// reload reads the file if it was modified
+func (f *FileResolver) reload() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		f.err = err
+		return
+	}
+	if f.endpoints != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		f.err = err
+		return
+	}
+	var endpoints map[string][]string
+	if err = json.Unmarshal(data, &endpoints); err != nil {
+		f.err = fmt.Errorf("parse %s: %w", f.path, err)
+		return
+	}
+	if endpoints == nil {
+		endpoints = make(map[string][]string)
+	}
+	f.endpoints, f.modTime, f.size, f.err = endpoints, info.ModTime(), info.Size(), nil
+}
+
+// FakeResolver is a Resolver of fixed endpoints for tests
+type FakeResolver struct {
+	mu        sync.Mutex
+	endpoints map[string][]string
+	errs      map[string]error
+}
+
+func NewFakeResolver(endpoints map[string][]string) *FakeResolver {
+	r := &FakeResolver{endpoints: make(map[string][]string), errs: make(map[string]error)}
+	for name, values := range endpoints {
+		r.endpoints[name] = append([]string(nil), values...)
+	}
+	return r
+}
+
+// Set replaces the endpoints of name
+func (r *FakeResolver) Set(name string, endpoints ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints[name] = append([]string(nil), endpoints...)
+	delete(r.errs, name)
+}
+
+// SetError makes the resolution of name fail with err
+func (r *FakeResolver) SetError(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs[name] = err
+}
+
+func (r *FakeResolver) Resolve(_ context.Context, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, ok := r.errs[name]; ok {
+		return nil, err
+	}
+	if endpoints, ok := r.endpoints[name]; ok {
+		return append([]string(nil), endpoints...), nil
+	}
+	return []string{name}, nil
+}
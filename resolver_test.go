@@ -0,0 +1,331 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFakeResolver(t *testing.T) {
+	var hits [2]int32
+	var servers [2]*httptest.Server
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+		}))
+		defer servers[i].Close()
+	}
+	resolver := NewFakeResolver(map[string][]string{"books": {servers[0].URL}})
+	client := ConfigureTransport(DefaultTransport, WithResolver(resolver)).
+		Method(http.MethodGet).Endpoints("books")
+
+	if err := client.DoNop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	resolver.Set("books", servers[1].URL)
+	if err := client.DoNop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if hits[0] != 1 || hits[1] != 1 {
+		t.Errorf("hits %v, want one per server", hits)
+	}
+
+	errDown := errors.New("registry down")
+	resolver.SetError("books", errDown)
+	if err := client.DoNop(context.Background()); !errors.Is(err, errDown) {
+		t.Errorf("error %v, want the resolver error", err)
+	}
+}
+
+func TestChainResolver(t *testing.T) {
+	resolver := ChainResolver(
+		NewFakeResolver(map[string][]string{"books": {"books-a", "books-b"}}),
+		NewFakeResolver(map[string][]string{"books-a": {"http://10.0.0.1:80"}, "books-b": {"http://10.0.0.2:80"}}),
+	)
+	got, err := resolver.Resolve(context.Background(), "books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://10.0.0.1:80", "http://10.0.0.2:80"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolved %v, want %v", got, want)
+	}
+	if got, _ := resolver.Resolve(context.Background(), "http://other:80"); !reflect.DeepEqual(got, []string{"http://other:80"}) {
+		t.Errorf("unknown name resolved into %v", got)
+	}
+}
+
+// fakeSRV is a lookup of SRV records which can be blocked
+type fakeSRV struct {
+	mu      sync.Mutex
+	records []*net.SRV
+	err     error
+	calls   int32
+	block   chan struct{}
+}
+
+func (f *fakeSRV) lookup(context.Context, string, string, string) (string, []*net.SRV, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return "", f.records, f.err
+}
+
+func (f *fakeSRV) set(err error, records ...*net.SRV) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records, f.err = records, err
+}
+
+func TestDNSResolver(t *testing.T) {
+	srv := &fakeSRV{block: make(chan struct{})}
+	srv.set(nil,
+		&net.SRV{Target: "b.svc.", Port: 80, Priority: 1, Weight: 10},
+		&net.SRV{Target: "a.svc.", Port: 80, Priority: 0, Weight: 10},
+		&net.SRV{Target: "c.svc.", Port: 8080, Priority: 0, Weight: 20},
+	)
+	var mu sync.Mutex
+	now := time.Now()
+	resolver := NewDNSResolver(time.Minute).(*dnsResolver)
+	resolver.lookup = srv.lookup
+	resolver.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	const name = "srv+http://_books._tcp.svc/v1"
+
+	// the concurrent resolutions share a lookup
+	var wg sync.WaitGroup
+	results := make([][]string, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if results[i], err = resolver.Resolve(context.Background(), name); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&srv.calls) == 1 })
+	close(srv.block)
+	wg.Wait()
+	// the backup target of priority 1 is left out
+	want := []string{"http://c.svc:8080/v1", "http://a.svc:80/v1"}
+	for _, got := range results {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("resolved %v, want %v", got, want)
+		}
+	}
+
+	// the endpoints are cached until they expire
+	if _, err := resolver.Resolve(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&srv.calls); got != 1 {
+		t.Fatalf("%d lookups, want 1", got)
+	}
+
+	// the expired endpoints are returned while they are looked up again
+	srv.block = make(chan struct{})
+	srv.set(nil, &net.SRV{Target: "d.svc.", Port: 80})
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	got, err := resolver.Resolve(context.Background(), name)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolved %v, %v while refreshing, want %v", got, err, want)
+	}
+	close(srv.block)
+	waitFor(t, func() bool {
+		got, _ := resolver.Resolve(context.Background(), name)
+		return reflect.DeepEqual(got, []string{"http://d.svc:80/v1"})
+	})
+
+	// a failed lookup keeps the stale endpoints
+	srv.set(errors.New("timeout"))
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	calls := atomic.LoadInt32(&srv.calls)
+	_, _ = resolver.Resolve(context.Background(), name)
+	waitFor(t, func() bool {
+		resolver.mu.Lock()
+		defer resolver.mu.Unlock()
+		return atomic.LoadInt32(&srv.calls) == calls+1 && resolver.entries["_books._tcp.svc"].lookup == nil
+	})
+	if got, err := resolver.Resolve(context.Background(), name); err != nil ||
+		!reflect.DeepEqual(got, []string{"http://d.svc:80/v1"}) {
+		t.Errorf("resolved %v, %v after a failed lookup", got, err)
+	}
+	if got := atomic.LoadInt32(&srv.calls); got != calls+1 {
+		t.Errorf("%d lookups, want the failed one retried after refresh", got-calls)
+	}
+}
+
+func TestDNSResolverPriorities(t *testing.T) {
+	srv := &fakeSRV{}
+	srv.set(nil,
+		&net.SRV{Target: "backup.svc.", Port: 80, Priority: 20, Weight: 1},
+		&net.SRV{Target: "b.svc.", Port: 80, Priority: 10, Weight: 1},
+		&net.SRV{Target: "a.svc.", Port: 80, Priority: 10, Weight: 5},
+		&net.SRV{Target: "last.svc.", Port: 80, Priority: 30, Weight: 1},
+	)
+	unhealthy := map[string]bool{}
+	var mu sync.Mutex
+	resolver := NewDNSResolver(time.Minute, WithEndpointHealth(func(endpoint string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return !unhealthy[endpoint]
+	})).(*dnsResolver)
+	resolver.lookup = srv.lookup
+	setUnhealthy := func(endpoints ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		unhealthy = map[string]bool{}
+		for _, endpoint := range endpoints {
+			unhealthy[endpoint] = true
+		}
+	}
+	tests := []struct {
+		name      string
+		unhealthy []string
+		want      []string
+	}{
+		{
+			name: "lowest priority",
+			want: []string{"http://a.svc:80", "http://b.svc:80"},
+		},
+		{
+			name:      "a healthy target left",
+			unhealthy: []string{"http://a.svc:80"},
+			want:      []string{"http://a.svc:80", "http://b.svc:80"},
+		},
+		{
+			name:      "backup",
+			unhealthy: []string{"http://a.svc:80", "http://b.svc:80"},
+			want:      []string{"http://backup.svc:80"},
+		},
+		{
+			name:      "next backup",
+			unhealthy: []string{"http://a.svc:80", "http://b.svc:80", "http://backup.svc:80"},
+			want:      []string{"http://last.svc:80"},
+		},
+		{
+			name:      "none healthy",
+			unhealthy: []string{"http://a.svc:80", "http://b.svc:80", "http://backup.svc:80", "http://last.svc:80"},
+			want:      []string{"http://a.svc:80", "http://b.svc:80"},
+		},
+	}
+	for _, tt := range tests {
+		setUnhealthy(tt.unhealthy...)
+		got, err := resolver.Resolve(context.Background(), "srv+http://_books._tcp.svc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: resolved %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// without health, the backups are never resolved
+	resolver = NewDNSResolver(time.Minute).(*dnsResolver)
+	resolver.lookup = srv.lookup
+	got, err := resolver.Resolve(context.Background(), "srv+http://_books._tcp.svc")
+	if err != nil || !reflect.DeepEqual(got, []string{"http://a.svc:80", "http://b.svc:80"}) {
+		t.Errorf("resolved %v, %v without health", got, err)
+	}
+}
+
+func TestDNSResolverErrors(t *testing.T) {
+	srv := &fakeSRV{}
+	resolver := NewDNSResolver(time.Minute).(*dnsResolver)
+	resolver.lookup = srv.lookup
+	if _, err := resolver.Resolve(context.Background(), "srv+http://_books._tcp.svc"); err == nil {
+		t.Error("expected an error without records")
+	}
+	errNX := errors.New("no such host")
+	srv.set(errNX)
+	if _, err := resolver.Resolve(context.Background(), "srv+http://_books._tcp.svc"); !errors.Is(err, errNX) {
+		t.Errorf("error %v, want the lookup error", err)
+	}
+	if got, err := resolver.Resolve(context.Background(), "http://books:80"); err != nil ||
+		!reflect.DeepEqual(got, []string{"http://books:80"}) {
+		t.Errorf("resolved %v, %v for a name without srv", got, err)
+	}
+	if got := atomic.LoadInt32(&srv.calls); got != 2 {
+		t.Errorf("%d lookups, want 2", got)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "endpoints.json")
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewFileResolver(filepath.Join(dir, "missing", "endpoints.json")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+
+	files, err := NewFileResolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer files.Close()
+	if _, err := files.Resolve(context.Background(), "books"); err == nil {
+		t.Error("expected an error before the file exists")
+	}
+	check := func(want ...string) {
+		t.Helper()
+		waitFor(t, func() bool {
+			got, err := files.Resolve(context.Background(), "books")
+			return err == nil && reflect.DeepEqual(got, want)
+		})
+	}
+
+	write("endpoints.json", `{"books": ["http://10.0.0.1:80"]}`)
+	check("http://10.0.0.1:80")
+
+	write("endpoints.json", `{"books": ["http://10.0.0.1:80", "http://10.0.0.2:80"]}`)
+	check("http://10.0.0.1:80", "http://10.0.0.2:80")
+
+	// a file replaced by a rename
+	write("endpoints.json.tmp", `{"books": ["http://10.0.0.3:80"]}`)
+	if err := os.Rename(filepath.Join(dir, "endpoints.json.tmp"), path); err != nil {
+		t.Fatal(err)
+	}
+	check("http://10.0.0.3:80")
+
+	// the last valid content is kept
+	write("endpoints.json", `{"books": [`)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	check("http://10.0.0.3:80")
+	if got, _ := files.Resolve(context.Background(), "authors"); !reflect.DeepEqual(got, []string{"authors"}) {
+		t.Errorf("unknown name resolved into %v", got)
+	}
+
+	if err := files.Close(); err != nil {
+		t.Error(err)
+	}
+}
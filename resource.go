@@ -1,48 +1,171 @@
 package rest
 
-import "net/http"
-
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// Handler holds the endpoint, the resource and the defaults shared by the clients of a resource,
+// resources can be nested, e.g. Resource("projects").Name(p).Resource("books") scopes to projects/{p}/books
 type Handler interface {
-	Endpoint(endpoint string) Handler
+	// Endpoint sets the endpoints of the clients created from the handler, see RESTClient.Endpoints
+	Endpoint(endpoints ...string) Handler
+	// Resource scopes the handler to the resource, it is nested into the current resource if that is named,
+	// otherwise it replaces it
 	Resource(resource string) Handler
+	// Name scopes the handler to the named object of the current resource
+	Name(name string) Handler
+	// Header sets a default header of the clients created from the handler
+	Header(key string, values ...string) Handler
+	// Query sets a default query parameter of the clients created from the handler
+	Query(key string, values ...string) Handler
+	// UserAgent sets the default User-Agent of the clients created from the handler
+	UserAgent(userAgent string) Handler
 	To() Transport
 }
 
-func NewHandler() Handler {
-	return &resourceHandler{}
+// ResourceHandler is a Handler scoped to a resource, whose named objects are handled by
+// the typed sub handlers S, e.g. the projects whose objects hold books
+type ResourceHandler[S any] struct {
+	Handler
+	sub func(Handler) S
 }
 
-type resourceHandler struct {
-	resource string
-	endpoint string
+// NewResourceHandler scopes h to resource, sub wraps the handler of a named object of the resource
+func NewResourceHandler[S any](h Handler, resource string, sub func(Handler) S) ResourceHandler[S] {
+	return ResourceHandler[S]{Handler: h.Resource(resource), sub: sub}
+}
+
+// Named returns the sub handlers of the object name
+func (r ResourceHandler[S]) Named(name string) S {
+	return r.sub(r.Handler.Name(name))
+}
+
+// HandlerOption configures the handler created by NewHandler
+type HandlerOption func(*resourceHandler)
+
+// WithTransport sets the transport of the handler, DefaultTransport is used by default
+func WithTransport(transport Transport) HandlerOption {
+	return func(r *resourceHandler) {
+		r.transport = transport
+	}
 }
 
-func (r *resourceHandler) Endpoint(endpoint string) Handler {
-	return &resourceHandler{
-		resource: r.resource,
-		endpoint: endpoint,
+func NewHandler(opts ...HandlerOption) Handler {
+	r := &resourceHandler{transport: DefaultTransport}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
+}
+
+type resourceScope struct {
+	resource string
+	name     string
+}
+
+type resourceHandler struct {
+	transport Transport
+	scopes    []resourceScope
+	endpoints []string
+	headers   http.Header
+	query     url.Values
+	userAgent string
+	err       error
+}
+
+func (r *resourceHandler) Endpoint(endpoints ...string) Handler {
+	c := *r
+	c.endpoints = append([]string(nil), endpoints...)
+	return &c
 }
 
 func (r *resourceHandler) Resource(resource string) Handler {
-	return &resourceHandler{
-		resource: resource,
-		endpoint: r.endpoint,
+	c := *r
+	n := len(r.scopes)
+	if n != 0 && r.scopes[n-1].name == "" {
+		n--
+	}
+	c.scopes = append(r.scopes[:n:n], resourceScope{resource: resource})
+	return &c
+}
+
+func (r *resourceHandler) Name(name string) Handler {
+	c := *r
+	if name == "" {
+		if c.err == nil {
+			c.err = fmt.Errorf("resource name may not be empty")
+		}
+		return &c
+	}
+	n := len(r.scopes)
+	if n == 0 || r.scopes[n-1].name != "" {
+		if c.err == nil {
+			c.err = fmt.Errorf("resource name %q must follow a resource", name)
+		}
+		return &c
 	}
+	c.scopes = append(r.scopes[:n-1:n-1], resourceScope{resource: r.scopes[n-1].resource, name: name})
+	return &c
+}
+
+func (r *resourceHandler) Header(key string, values ...string) Handler {
+	c := *r
+	c.headers = cloneValues(r.headers)
+	if c.headers == nil {
+		c.headers = make(http.Header)
+	}
+	if len(values) == 0 {
+		c.headers.Del(key)
+		return &c
+	}
+	c.headers[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	return &c
+}
+
+func (r *resourceHandler) Query(key string, values ...string) Handler {
+	c := *r
+	c.query = cloneValues(r.query)
+	if c.query == nil {
+		c.query = make(url.Values)
+	}
+	if len(values) == 0 {
+		c.query.Del(key)
+		return &c
+	}
+	c.query[key] = append([]string(nil), values...)
+	return &c
+}
+
+func (r *resourceHandler) UserAgent(userAgent string) Handler {
+	c := *r
+	c.userAgent = userAgent
+	return &c
 }
 
 func (r *resourceHandler) To() Transport {
+	// the defaults of the handler take precedence over those of the transport
+	opts := []TransportOption{WithHeaders(r.headers), WithQuerys(r.query)}
+	if r.userAgent != "" {
+		opts = append(opts, WithUserAgent(r.userAgent))
+	}
+	t := ConfigureTransport(r.transport, opts...)
 	return &fixTransport{
-		t:        DefaultTransport,
-		resource: r.resource,
-		endpoint: r.endpoint,
+		t:         t,
+		scopes:    r.scopes,
+		endpoints: r.endpoints,
+		err:       r.err,
 	}
 }
 
 type fixTransport struct {
-	t        Transport
-	resource string
-	endpoint string
+	// t is the OptionsTransport holding the defaults of the handler
+	t         Transport
+	scopes    []resourceScope
+	endpoints []string
+	err       error
 }
 
 func (t *fixTransport) RoundTrip(request *http.Request) (*http.Response, error) {
@@ -50,27 +173,27 @@ func (t *fixTransport) RoundTrip(request *http.Request) (*http.Response, error)
 }
 
 func (t *fixTransport) WithRequest(requester Requester) Transport {
-	return &fixTransport{
-		t:        t.t.WithRequest(requester),
-		resource: t.resource,
-		endpoint: t.endpoint,
-	}
+	c := *t
+	c.t = t.t.WithRequest(requester)
+	return &c
 }
 
 func (t *fixTransport) WithClient(roundTripper http.RoundTripper) Transport {
-	return &fixTransport{
-		t:        t.t.WithClient(roundTripper),
-		resource: t.resource,
-		endpoint: t.endpoint,
-	}
+	c := *t
+	c.t = t.t.WithClient(roundTripper)
+	return &c
 }
 
 func (t *fixTransport) WithResponse(response Response) Transport {
-	return &fixTransport{
-		t:        t.t.WithResponse(response),
-		resource: t.resource,
-		endpoint: t.endpoint,
-	}
+	c := *t
+	c.t = t.t.WithResponse(response)
+	return &c
+}
+
+func (t *fixTransport) WithOptions(opts TransportOptions) Transport {
+	c := *t
+	c.t = t.t.(OptionsTransport).WithOptions(opts)
+	return &c
 }
 
 func (t *fixTransport) Request() Requester {
@@ -85,6 +208,32 @@ func (t *fixTransport) Client() http.RoundTripper {
 	return t.t.Client()
 }
 
+func (t *fixTransport) Options() TransportOptions {
+	return TransportOptionsOf(t.t)
+}
+
 func (t *fixTransport) Method(method string) RESTClient {
-	return NewRESTClient(t.t, method).Endpoints(t.endpoint).Resource(t.resource)
+	r := NewRESTClient(t, method)
+	if t.err != nil {
+		return r.AddError(t.err)
+	}
+	n := len(t.scopes)
+	if n == 0 {
+		return r.Endpoints(t.endpoints...)
+	}
+	// the parent resources are placed between the prefix and the resource of the client
+	for _, scope := range t.scopes[:n-1] {
+		if reasons := IsValidPathSegmentName(scope.resource); len(reasons) != 0 {
+			return r.AddError(fmt.Errorf("invalid resource %q: %v", scope.resource, reasons))
+		}
+		if reasons := IsValidPathSegmentName(scope.name); len(reasons) != 0 {
+			return r.AddError(fmt.Errorf("invalid resource name %q: %v", scope.name, reasons))
+		}
+		r.parentPath = path.Join(r.parentPath, scope.resource, scope.name)
+	}
+	c := r.Endpoints(t.endpoints...).Resource(t.scopes[n-1].resource)
+	if name := t.scopes[n-1].name; name != "" {
+		c = c.Name(name)
+	}
+	return c
 }
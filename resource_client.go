@@ -0,0 +1,212 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// ListOptions selects a page of a list
+type ListOptions struct {
+	Offset int `form:"offset"`
+	Limit  int `form:"limit,omitempty"`
+	// Continue is the token of the page returned by the ContinuePage before it
+	Continue string `form:"continue,omitempty"`
+}
+
+// ListPage can be implemented by a page of objects to tell ListPages its length,
+// otherwise the length of its field of type []T is used
+type ListPage interface {
+	Len() int
+}
+
+// ContinuePage can be implemented by a page of objects paginated by token
+type ContinuePage interface {
+	// Continue returns the token of the next page, empty for the last page
+	Continue() string
+}
+
+// ResourceClient is a typed client of the resource of a Handler,
+// T is the type of the objects and ListT the type of a page of objects, e.g.
+//
+//	books := rest.NewResourceClient[Book, BookList](handler.Resource("books"))
+type ResourceClient[T any, ListT any] struct {
+	handler Handler
+}
+
+func NewResourceClient[T any, ListT any](handler Handler) *ResourceClient[T, ListT] {
+	return &ResourceClient[T, ListT]{handler: handler}
+}
+
+// Handler returns the handler the client is built on
+func (c *ResourceClient[T, ListT]) Handler() Handler {
+	return c.handler
+}
+
+func (c *ResourceClient[T, ListT]) Get(ctx context.Context, name string, opts ...interface{}) (*T, error) {
+	var result T
+	if err := querys(c.handler.To().Method(http.MethodGet).Name(name), opts).
+		Do(ctx, &result, ErrorFunc(http.StatusOK)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// List lists the objects, every option is encoded into the query parameters by Querys
+func (c *ResourceClient[T, ListT]) List(ctx context.Context, opts ...interface{}) (*ListT, error) {
+	var result ListT
+	if err := querys(c.handler.To().Method(http.MethodGet), opts).
+		Do(ctx, &result, ErrorFunc(http.StatusOK)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListPages lists the objects page by page starting from page, fn is called with every page
+// until it returns false or an error. A ContinuePage is followed by its token until it has none,
+// otherwise the offset is moved by the limit until a page is shorter than it.
+// The listing stops at an empty page, which isn't passed to fn
+func (c *ResourceClient[T, ListT]) ListPages(ctx context.Context, page ListOptions,
+	fn func(list *ListT) (bool, error), opts ...interface{}) error {
+	if page.Limit <= 0 {
+		return errors.New("page limit must be positive")
+	}
+	for {
+		list, err := c.List(ctx, append(opts[:len(opts):len(opts)], page)...)
+		if err != nil {
+			return err
+		}
+		n, counted := pageLen[T](list)
+		if counted && n == 0 {
+			return nil
+		}
+		more, err := fn(list)
+		if err != nil || !more {
+			return err
+		}
+		if p, ok := interface{}(list).(ContinuePage); ok {
+			if page.Continue = p.Continue(); page.Continue == "" {
+				return nil
+			}
+			continue
+		}
+		if counted && n < page.Limit {
+			return nil
+		}
+		page.Offset += page.Limit
+	}
+}
+
+// pageLen returns the length of list, from its Len method or its first field of type []T,
+// counted is false if it has none
+func pageLen[T any, ListT any](list *ListT) (n int, counted bool) {
+	if p, ok := interface{}(list).(ListPage); ok {
+		return p.Len(), true
+	}
+	v := reflect.ValueOf(list).Elem()
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	itemsType := reflect.TypeOf([]T(nil))
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).IsExported() && v.Field(i).Type() == itemsType {
+			return v.Field(i).Len(), true
+		}
+	}
+	return 0, false
+}
+
+func (c *ResourceClient[T, ListT]) Create(ctx context.Context, obj *T, opts ...interface{}) (*T, error) {
+	var result T
+	if err := querys(c.handler.To().Method(http.MethodPost).Body(obj), opts).
+		Do(ctx, &result, ErrorFunc(http.StatusOK, http.StatusCreated, http.StatusAccepted)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *ResourceClient[T, ListT]) Update(ctx context.Context, name string, obj *T, opts ...interface{}) (*T, error) {
+	var result T
+	if err := querys(c.handler.To().Method(http.MethodPut).Name(name).Body(obj), opts).
+		Do(ctx, &result, ErrorFunc(http.StatusOK, http.StatusAccepted)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Patch sends patch with its media type if it is a PatchDocument, otherwise as JSON merge patch
+func (c *ResourceClient[T, ListT]) Patch(ctx context.Context, name string, patch interface{}, opts ...interface{}) (*T, error) {
+	p, ok := patch.(PatchDocument)
+	if !ok {
+		p = MergePatch(patch)
+	}
+	var result T
+	if err := querys(c.handler.To().Method(http.MethodPatch).Name(name).PatchBody(p), opts).
+		Do(ctx, &result, ErrorFunc(http.StatusOK, http.StatusAccepted)); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *ResourceClient[T, ListT]) Delete(ctx context.Context, name string, opts ...interface{}) error {
+	return querys(c.handler.To().Method(http.MethodDelete).Name(name), opts).
+		DoNop(ctx, ErrorFunc(http.StatusOK, http.StatusAccepted, http.StatusNoContent))
+}
+
+// Watch requests the changes of the objects with the query watch=true,
+// the response is expected to be a stream of JSON encoded WatchEvent
+func (c *ResourceClient[T, ListT]) Watch(ctx context.Context, opts ...interface{}) (*Watcher[T], error) {
+	body, err := querys(c.handler.To().Method(http.MethodGet), opts).
+		SetQuery("watch", "true").
+		Stream(ctx, ErrorFunc(http.StatusOK))
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	return &Watcher[T]{body: body, decoder: decoder}, nil
+}
+
+func querys(r RESTClient, opts []interface{}) RESTClient {
+	for _, opt := range opts {
+		r = r.Querys(opt)
+	}
+	return r
+}
+
+type EventType string
+
+const (
+	EventAdded    EventType = "ADDED"
+	EventModified EventType = "MODIFIED"
+	EventDeleted  EventType = "DELETED"
+	EventError    EventType = "ERROR"
+)
+
+// WatchEvent is a change of an object
+type WatchEvent[T any] struct {
+	Type   EventType `json:"type"`
+	Object T         `json:"object"`
+}
+
+// Watcher decodes the events of a watch
+type Watcher[T any] struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+}
+
+// Next blocks until the next event, io.EOF is returned when the server ends the watch
+func (w *Watcher[T]) Next() (*WatchEvent[T], error) {
+	var event WatchEvent[T]
+	if err := w.decoder.Decode(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (w *Watcher[T]) Close() error {
+	return w.body.Close()
+}
@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type testBook struct {
+	Name string `json:"name"`
+}
+
+type testBookList struct {
+	List  []testBook `json:"list"`
+	Total int        `json:"total"`
+}
+
+type testBookTokenList struct {
+	Items []testBook `json:"items"`
+	Next  string     `json:"next"`
+}
+
+func (l *testBookTokenList) Continue() string {
+	return l.Next
+}
+
+// newBookServer serves total books by offset and limit, or by the token continue
+func newBookServer(total int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		query := r.URL.Query()
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		if token := query.Get("continue"); token != "" {
+			offset, _ = strconv.Atoi(token)
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		books := []testBook{}
+		for i := offset; i < total && i < offset+limit; i++ {
+			books = append(books, testBook{Name: strconv.Itoa(i)})
+		}
+		next := ""
+		if offset+limit < total {
+			next = strconv.Itoa(offset + limit)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"list": books, "items": books, "total": total, "next": next})
+	}))
+}
+
+func TestResourceClientListPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		total        int
+		wantPages    int
+		wantRequests int
+	}{
+		{name: "short last page", total: 5, wantPages: 3, wantRequests: 3},
+		{name: "empty last page", total: 4, wantPages: 2, wantRequests: 3},
+		{name: "empty list", total: 0, wantPages: 0, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, pages, books int
+			server := newBookServer(tt.total, &requests)
+			defer server.Close()
+
+			client := NewResourceClient[testBook, testBookList](NewHandler().Endpoint(server.URL).Resource("books"))
+			err := client.ListPages(context.Background(), ListOptions{Limit: 2}, func(list *testBookList) (bool, error) {
+				pages++
+				books += len(list.List)
+				return true, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages != tt.wantPages || requests != tt.wantRequests || books != tt.total {
+				t.Errorf("%d pages, %d requests, %d books, want %d, %d, %d",
+					pages, requests, books, tt.wantPages, tt.wantRequests, tt.total)
+			}
+		})
+	}
+}
+
+func TestResourceClientListPagesContinue(t *testing.T) {
+	var requests int
+	server := newBookServer(4, &requests)
+	defer server.Close()
+
+	var names []string
+	client := NewResourceClient[testBook, testBookTokenList](NewHandler().Endpoint(server.URL).Resource("books"))
+	err := client.ListPages(context.Background(), ListOptions{Limit: 2}, func(list *testBookTokenList) (bool, error) {
+		for _, book := range list.Items {
+			names = append(names, book.Name)
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last page has no token, so no empty page is requested
+	if len(names) != 4 || requests != 2 {
+		t.Errorf("books %v in %d requests", names, requests)
+	}
+}
+
+func TestResourceClientListPagesStop(t *testing.T) {
+	var requests int
+	server := newBookServer(10, &requests)
+	defer server.Close()
+
+	errStop := errors.New("stop")
+	client := NewResourceClient[testBook, testBookList](NewHandler().Endpoint(server.URL).Resource("books"))
+	err := client.ListPages(context.Background(), ListOptions{Limit: 2}, func(list *testBookList) (bool, error) {
+		return false, nil
+	})
+	if err != nil || requests != 1 {
+		t.Errorf("error %v after %d requests", err, requests)
+	}
+	err = client.ListPages(context.Background(), ListOptions{Limit: 2}, func(list *testBookList) (bool, error) {
+		return true, errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("error %v, want %v", err, errStop)
+	}
+	if err = client.ListPages(context.Background(), ListOptions{}, nil); err == nil {
+		t.Error("expected an error without limit")
+	}
+}
+
+func TestResourceClientStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code":"BookNotFound","message":"book 12 not found"}`))
+	}))
+	defer server.Close()
+
+	client := NewResourceClient[testBook, testBookList](NewHandler().Endpoint(server.URL).Resource("books"))
+	_, err := client.Get(context.Background(), "12")
+	if !IsNotFound(err) {
+		t.Fatalf("error %v, want not found", err)
+	}
+	if want := "code:BookNotFound, message:book 12 not found, result:<nil>"; err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+)
+
+type projectHandler struct {
+	Handler
+}
+
+func (p projectHandler) Books() Handler {
+	return p.Resource("books")
+}
+
+func TestHandlerScopes(t *testing.T) {
+	base := NewHandler().Endpoint("http://localhost:80")
+	projects := NewResourceHandler(base, "projects", func(h Handler) projectHandler { return projectHandler{h} })
+	tests := []struct {
+		name    string
+		client  RESTClient
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "resource",
+			client: base.Resource("books").To().Method(http.MethodGet).Name("b1"),
+			want:   "http://localhost:80/books/b1",
+		},
+		{
+			name:   "nested resource",
+			client: base.Resource("projects").Name("p1").Resource("books").To().Method(http.MethodGet).Name("b1"),
+			want:   "http://localhost:80/projects/p1/books/b1",
+		},
+		{
+			name:   "unnamed resource replaced",
+			client: base.Resource("projects").Resource("books").To().Method(http.MethodGet),
+			want:   "http://localhost:80/books",
+		},
+		{
+			name:   "named resource",
+			client: base.Resource("projects").Name("p1").To().Method(http.MethodGet).SubResource("members"),
+			want:   "http://localhost:80/projects/p1/members",
+		},
+		{
+			name:   "typed sub handler",
+			client: projects.Named("p1").Books().To().Method(http.MethodGet).Name("b1"),
+			want:   "http://localhost:80/projects/p1/books/b1",
+		},
+		{
+			name:    "empty name",
+			client:  base.Resource("projects").Name("").Resource("books").To().Method(http.MethodGet),
+			wantErr: true,
+		},
+		{
+			name:    "empty typed name",
+			client:  projects.Named("").Books().To().Method(http.MethodGet),
+			wantErr: true,
+		},
+		{
+			name:    "name without resource",
+			client:  base.Name("p1").To().Method(http.MethodGet),
+			wantErr: true,
+		},
+		{
+			name:    "invalid parent name",
+			client:  base.Resource("projects").Name("a/b").Resource("books").To().Method(http.MethodGet),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.client.(*restfulClient)
+			if tt.wantErr {
+				if r.err == nil {
+					t.Fatalf("expected an error, got %s", r.finalURL())
+				}
+				return
+			}
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if got := r.finalURL().String(); got != tt.want {
+				t.Errorf("URL %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerKeepsTransport(t *testing.T) {
+	rt := roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+	handler := NewHandler(WithTransport(DefaultTransport.WithClient(rt))).Resource("books")
+	if _, ok := handler.To().Client().(roundTripperFunc); !ok {
+		t.Errorf("client %T, want the one of the transport", handler.To().Client())
+	}
+}
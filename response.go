@@ -23,11 +23,16 @@ func (j JsonResponse) Parse(resp *http.Response, result interface{}, opts ...fun
 	if resp.StatusCode == http.StatusNoContent || result == nil {
 		return nil
 	}
-	if err := j.checkContentType(resp.Header.Get("Content-Type")); err != nil {
+	contentType := resp.Header.Get("Content-Type")
+	if err := j.checkContentType(contentType); err != nil {
+		return err
+	}
+	body, err := CharsetReader(resp.Body, contentType)
+	if err != nil {
 		return err
 	}
 
-	decoder := json.NewDecoder(resp.Body)
+	decoder := json.NewDecoder(body)
 	decoder.UseNumber()
 	return decoder.Decode(result)
 }
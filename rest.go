@@ -1,9 +1,9 @@
 package rest
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,9 +17,24 @@ import (
 	"go.uber.org/multierr"
 )
 
+// RESTClient builds and sends a request, every builder method returns a new RESTClient
+// and leaves the receiver unchanged, so a partially built client can be shared across goroutines
+// as a template.
+//
+// Headers and query parameters are applied in the order of the calls:
+// Header, Query (add) and Headers, Querys (merge) keep the values set before,
+// SetHeader, SetQuery (set) and ReplaceHeaders, ReplaceQuerys (replace) discard them,
+// so a later call always takes precedence over an earlier one.
+// The defaults of the Transport, which already include those of a Handler,
+// are replaced key by key by the values set on the client, and discarded by ReplaceHeaders
+// and ReplaceQuerys
 type RESTClient interface {
-	// Endpoints  add  endpoints to the client
-	Endpoints(endpoint string) RESTClient
+	// Clone returns a copy of the client
+	Clone() RESTClient
+
+	// Endpoints sets the base URLs of the request, with several endpoints every attempt is sent
+	// to the one picked by the Balancer of the Transport, and a retry fails over to another one
+	Endpoints(endpoints ...string) RESTClient
 
 	Prefix(segments ...string) RESTClient
 
@@ -31,26 +46,76 @@ type RESTClient interface {
 
 	SubResource(subResources ...string) RESTClient
 
+	// Path appends the path template like /projects/{project}/books/{id}:archive,
+	// every placeholder is substituted with the percent-escaped value from params
+	Path(template string, params map[string]string) RESTClient
+
+	// Query adds the values to the query parameter key, the key is deleted if no value is given
 	Query(key string, value ...string) RESTClient
 
+	// SetQuery replaces the values of the query parameter key
+	SetQuery(key string, values ...string) RESTClient
+
+	// Querys encodes value by the Encoder and merges it into the query parameters,
+	// values which are already present are not added twice
 	Querys(value interface{}) RESTClient
 
+	// ReplaceQuerys encodes value by the Encoder and replaces all the query parameters with it
+	ReplaceQuerys(value interface{}) RESTClient
+
+	// Encoder replaces the encoder used by Querys, which is the *schema.Encoder reading the form tag
+	// by default, or a QueryEncoder for the values using its tag options, marshalers or pointers to time.Time,
+	// e.g. NewQueryEncoder for the styles of arrays and nested objects of every value
+	Encoder(encoder Encoder) RESTClient
+
+	// Headers merges header into the headers, values which are already present are not added twice
 	Headers(header http.Header) RESTClient
 
+	// ReplaceHeaders replaces all the headers with header
+	ReplaceHeaders(header http.Header) RESTClient
+
+	// Header adds the values to the header key, the key is deleted if no value is given
 	Header(key string, values ...string) RESTClient
 
+	// SetHeader replaces the values of the header key
+	SetHeader(key string, values ...string) RESTClient
+
 	Body(obj interface{}) RESTClient
 
+	// PatchBody sets the body to the patch and the Content-Type to its media type
+	PatchBody(patch PatchDocument) RESTClient
+
+	// IfMatch makes the request conditional on the current ETag of the resource being one of etags
+	IfMatch(etags ...string) RESTClient
+
+	// IfNoneMatch makes the request conditional on the current ETag of the resource being none of etags
+	IfNoneMatch(etags ...string) RESTClient
+
+	// IfUnmodifiedSince makes the request conditional on the resource not being modified since t
+	IfUnmodifiedSince(t time.Time) RESTClient
+
+	// Retry retries the request after the delays of backoff while shouldRetryFunc returns true,
+	// a *backoff.ExponentialBackOff is copied for every call, other stateful backoffs like those of
+	// backoff.WithMaxRetries are shared by the calls of the client and its clones, use RetryFunc
+	// for a client sent concurrently
 	Retry(backoff backoff.BackOff,
 		shouldRetryFunc func(*http.Response, error) bool) RESTClient
 
+	// RetryFunc is like Retry with a backoff returned by newBackOff for every call
+	RetryFunc(newBackOff func() backoff.BackOff,
+		shouldRetryFunc func(*http.Response, error) bool) RESTClient
+
 	Do(ctx context.Context, result interface{}, opts ...func(*http.Response) error) error
 
 	DoNop(ctx context.Context, opts ...func(*http.Response) error) error
 
 	DoRaw(ctx context.Context) ([]byte, error)
 
-	Stream(ctx context.Context) (io.ReadCloser, error)
+	// DoString returns the response body transcoded to UTF-8 according to its declared charset
+	DoString(ctx context.Context) (string, error)
+
+	// Stream returns the response body unread, opts are called with the response before
+	Stream(ctx context.Context, opts ...func(*http.Response) error) (io.ReadCloser, error)
 }
 
 // NameMayNotBe specifies strings that cannot be used as names specified as path segments (like the REST API or etcd store)
@@ -82,15 +147,27 @@ type restfulClient struct {
 
 	From    func(context.Context) Logger
 	baseURL *url.URL
+	// endpoints is set when there are several endpoints, baseURL is the first one
+	endpoints []string
 	// generic components accessible via method setters
 	verb         string
 	pathPrefix   string
+	parentPath   string
 	subPath      string
+	templatePath string
 	params       url.Values
 	QueryEncoder *schema.Encoder
-	headers      http.Header
+	// encoder replaces QueryEncoder if set
+	encoder Encoder
+	headers http.Header
+	// defaultParams and defaultHeaders are the defaults of the transport,
+	// the keys of params and headers replace them, a nil value deletes the key
+	defaultParams  url.Values
+	defaultHeaders http.Header
 	// retry
-	backoff         backoff.BackOff
+	backoff backoff.BackOff
+	// newBackOff replaces backoff if set
+	newBackOff      func() backoff.BackOff
 	shouldRetryFunc func(*http.Response, error) bool
 	// structural elements of the request that are part of the Kubernetes API conventions
 	resource     string
@@ -98,52 +175,132 @@ type restfulClient struct {
 	subresource  string
 
 	// output
-	err  error
-	body io.Reader
+	err error
+	// body is either []byte or io.Reader
+	body interface{}
 }
 
 // NewRESTClient start to reqest
 func NewRESTClient(transport Transport, method string) *restfulClient {
-	e := schema.NewEncoder()
-	e.SetAliasTag("form")
-
-	return &restfulClient{
+	r := &restfulClient{
 		c:            transport,
 		From:         Nop,
 		verb:         method,
-		QueryEncoder: e,
+		QueryEncoder: newSchemaEncoder(),
 		backoff:      &backoff.ZeroBackOff{},
 	}
+	opts := TransportOptionsOf(transport)
+	r.encoder = opts.Encoder
+	r.defaultParams = cloneValues(opts.Querys)
+	r.defaultHeaders = cloneValues(canonicalHeader(opts.Headers))
+	if opts.UserAgent != "" {
+		if r.defaultHeaders == nil {
+			r.defaultHeaders = make(http.Header)
+		}
+		r.defaultHeaders.Set("User-Agent", opts.UserAgent)
+	}
+	return r
+}
+
+func (r *restfulClient) Clone() RESTClient {
+	return r.clone()
+}
+
+// clone copies r, maps are copied so that the copy can be modified without affecting r
+func (r *restfulClient) clone() *restfulClient {
+	c := *r
+	if r.baseURL != nil {
+		baseURL := *r.baseURL
+		c.baseURL = &baseURL
+	}
+	if r.params != nil {
+		c.params = make(url.Values, len(r.params))
+		for key, values := range r.params {
+			c.params[key] = append([]string(nil), values...)
+		}
+	}
+	c.headers = r.headers.Clone()
+	return &c
 }
 
 func (r *restfulClient) AddError(err error) RESTClient {
+	r = r.clone()
 	r.err = multierr.Append(r.err, err)
 	return r
 }
 
-func (r *restfulClient) Endpoints(endpoint string) RESTClient {
-	if endpoint == "" {
-		return r
-	}
-	baseURL, err := url.Parse(endpoint)
-	if err != nil {
+func (r *restfulClient) Endpoints(endpoints ...string) RESTClient {
+	r = r.clone()
+	if err := r.setEndpoints(endpoints); err != nil {
 		return r.AddError(err)
 	}
-	r.baseURL = baseURL
 	return r
 }
 
+// setEndpoints sets the non-empty endpoints, they are left unchanged if there is none
+func (r *restfulClient) setEndpoints(endpoints []string) error {
+	var valid []string
+	for _, endpoint := range endpoints {
+		if endpoint == "" {
+			continue
+		}
+		if _, err := parseEndpoint(endpoint); err != nil {
+			return err
+		}
+		valid = append(valid, endpoint)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	r.baseURL, _ = parseEndpoint(valid[0])
+	r.endpoints = nil
+	if len(valid) > 1 {
+		r.endpoints = valid
+	}
+	return nil
+}
+
+// resolve returns a copy of r sending to the endpoints resolved by resolver
+func (r *restfulClient) resolve(ctx context.Context, resolver Resolver) (*restfulClient, error) {
+	names := r.endpoints
+	if len(names) == 0 {
+		if r.baseURL == nil {
+			return r, nil
+		}
+		names = []string{endpointOf(r.baseURL)}
+	}
+	var endpoints []string
+	for _, name := range names {
+		resolved, err := resolver.Resolve(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", name, err)
+		}
+		endpoints = append(endpoints, resolved...)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoint resolved from %v", names)
+	}
+	c := r.clone()
+	if err := c.setEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 func (r *restfulClient) Prefix(segments ...string) RESTClient {
+	r = r.clone()
 	r.pathPrefix = path.Join(r.pathPrefix, path.Join(segments...))
 	return r
 }
 
 func (r *restfulClient) Suffix(segments ...string) RESTClient {
+	r = r.clone()
 	r.subPath = path.Join(r.subPath, path.Join(segments...))
 	return r
 }
 
 func (r *restfulClient) Resource(resource string) RESTClient {
+	r = r.clone()
 	if len(r.resource) != 0 {
 		return r.AddError(fmt.Errorf("resource already set to %q, cannot change to %q", r.resource, resource))
 	}
@@ -155,6 +312,7 @@ func (r *restfulClient) Resource(resource string) RESTClient {
 }
 
 func (r *restfulClient) Name(resourceName string) RESTClient {
+	r = r.clone()
 	if len(resourceName) == 0 {
 		return r.AddError(fmt.Errorf("resource name may not be empty"))
 	}
@@ -169,6 +327,7 @@ func (r *restfulClient) Name(resourceName string) RESTClient {
 }
 
 func (r *restfulClient) SubResource(subResources ...string) RESTClient {
+	r = r.clone()
 	subresource := path.Join(subResources...)
 	if len(r.subresource) != 0 {
 		return r.AddError(fmt.Errorf("subresource already set to %q, cannot change to %q", r.subresource, subresource))
@@ -182,7 +341,18 @@ func (r *restfulClient) SubResource(subResources ...string) RESTClient {
 	return r
 }
 
+func (r *restfulClient) Path(template string, params map[string]string) RESTClient {
+	r = r.clone()
+	escaped, err := ExpandPathTemplate(template, params)
+	if err != nil {
+		return r.AddError(err)
+	}
+	r.templatePath = path.Join(r.templatePath, escaped)
+	return r
+}
+
 func (r *restfulClient) Query(key string, values ...string) RESTClient {
+	r = r.clone()
 	if key == "" {
 		return r
 	}
@@ -190,7 +360,7 @@ func (r *restfulClient) Query(key string, values ...string) RESTClient {
 		r.params = make(url.Values)
 	}
 	if len(values) == 0 {
-		r.params.Del(key)
+		r.params[key] = nil
 		return r
 	}
 	for _, value := range values {
@@ -199,81 +369,95 @@ func (r *restfulClient) Query(key string, values ...string) RESTClient {
 	return r
 }
 
-func (r *restfulClient) Querys(value interface{}) RESTClient {
-	if value == nil {
+func (r *restfulClient) SetQuery(key string, values ...string) RESTClient {
+	r = r.clone()
+	if key == "" {
 		return r
 	}
-	var form url.Values
-	switch v := value.(type) {
-	case url.Values:
-		form = v
-	case *url.Values:
-		form = *v
-	default:
-		if err := r.QueryEncoder.Encode(value, form); err != nil {
-			return r.AddError(err)
-		}
+	if r.params == nil {
+		r.params = make(url.Values)
 	}
-	if len(r.params) == 0 {
-		r.params = form
+	if len(values) == 0 {
+		r.params[key] = nil
 		return r
 	}
+	r.params[key] = append([]string(nil), values...)
+	return r
+}
+
+func (r *restfulClient) Querys(value interface{}) RESTClient {
+	r = r.clone()
+	form, err := r.encodeQuery(value)
+	if err != nil {
+		return r.AddError(err)
+	}
+	if r.params == nil {
+		r.params = make(url.Values, len(form))
+	}
+	mergeValues(r.params, form)
+	return r
+}
+
+func (r *restfulClient) ReplaceQuerys(value interface{}) RESTClient {
+	r = r.clone()
+	form, err := r.encodeQuery(value)
+	if err != nil {
+		return r.AddError(err)
+	}
 	r.params = make(url.Values, len(form))
-	for key, srcValues := range form {
-		dstValues, ok := r.params[key]
-		if !ok {
-			for _, srcValue := range srcValues {
-				r.params.Add(key, srcValue)
-			}
-			continue
+	r.defaultParams = nil
+	mergeValues(r.params, form)
+	return r
+}
+
+func (r *restfulClient) encodeQuery(value interface{}) (url.Values, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case url.Values:
+		return v, nil
+	case *url.Values:
+		return *v, nil
+	case map[string][]string:
+		return v, nil
+	default:
+		encoder := r.encoder
+		if encoder == nil {
+			encoder = queryEncoderFor(r.QueryEncoder, value)
 		}
-		for _, srcValue := range srcValues {
-			found := false
-			for _, dstValue := range dstValues {
-				if srcValue == dstValue {
-					found = true
-					break
-				}
-			}
-			if !found {
-				r.params.Add(key, srcValue)
-			}
+		form := make(url.Values)
+		if err := encoder.Encode(value, form); err != nil {
+			return nil, err
 		}
+		return form, nil
 	}
+}
+
+func (r *restfulClient) Encoder(encoder Encoder) RESTClient {
+	r = r.clone()
+	r.encoder = encoder
 	return r
 }
 
 func (r *restfulClient) Headers(header http.Header) RESTClient {
-	if len(r.headers) == 0 {
-		r.headers = header
-		return r
+	r = r.clone()
+	if r.headers == nil {
+		r.headers = make(http.Header, len(header))
 	}
+	mergeValues(r.headers, canonicalHeader(header))
+	return r
+}
+
+func (r *restfulClient) ReplaceHeaders(header http.Header) RESTClient {
+	r = r.clone()
 	r.headers = make(http.Header, len(header))
-	for key, srcValues := range header {
-		dstValues, ok := r.headers[key]
-		if !ok {
-			for _, srcValue := range srcValues {
-				r.headers.Add(key, srcValue)
-			}
-			continue
-		}
-		for _, srcValue := range srcValues {
-			found := false
-			for _, dstValue := range dstValues {
-				if srcValue == dstValue {
-					found = true
-					break
-				}
-			}
-			if !found {
-				r.headers.Add(key, srcValue)
-			}
-		}
-	}
+	r.defaultHeaders = nil
+	mergeValues(r.headers, canonicalHeader(header))
 	return r
 }
 
 func (r *restfulClient) Header(key string, values ...string) RESTClient {
+	r = r.clone()
 	if key == "" {
 		return r
 	}
@@ -281,7 +465,7 @@ func (r *restfulClient) Header(key string, values ...string) RESTClient {
 		r.headers = http.Header{}
 	}
 	if len(values) == 0 {
-		r.headers.Del(key)
+		r.headers[http.CanonicalHeaderKey(key)] = nil
 		return r
 	}
 	for _, value := range values {
@@ -290,49 +474,193 @@ func (r *restfulClient) Header(key string, values ...string) RESTClient {
 	return r
 }
 
+func (r *restfulClient) SetHeader(key string, values ...string) RESTClient {
+	r = r.clone()
+	if key == "" {
+		return r
+	}
+	if r.headers == nil {
+		r.headers = http.Header{}
+	}
+	if len(values) == 0 {
+		r.headers[http.CanonicalHeaderKey(key)] = nil
+		return r
+	}
+	r.headers[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	return r
+}
+
 func (r *restfulClient) Body(obj interface{}) RESTClient {
+	r = r.clone()
 	switch t := obj.(type) {
 	case string:
-		r.body = strings.NewReader(t)
+		r.body = []byte(t)
 	case []byte:
-		r.body = bytes.NewReader(t)
+		r.body = append([]byte(nil), t...)
 	case io.Reader:
+		// a reader can only be sent once, it is shared by the clones of r
 		r.body = t
 	default:
 		content, err := json.Marshal(t)
 		if err != nil {
 			return r.AddError(err)
 		}
-		r.body = bytes.NewReader(content)
-		r.Header("Content-Type", "application/json; charset=utf-8")
+		r.body = content
+		if r.headers == nil {
+			r.headers = make(http.Header)
+		}
+		r.headers.Set("Content-Type", "application/json; charset=utf-8")
 	}
 	return r
 }
 
+func (r *restfulClient) PatchBody(patch PatchDocument) RESTClient {
+	data, err := patch.Data()
+	if err != nil {
+		return r.AddError(err)
+	}
+	return r.Body(data).SetHeader("Content-Type", patch.Type())
+}
+
+func (r *restfulClient) IfMatch(etags ...string) RESTClient {
+	if len(etags) == 0 {
+		return r.SetHeader("If-Match")
+	}
+	return r.SetHeader("If-Match", strings.Join(etags, ", "))
+}
+
+func (r *restfulClient) IfNoneMatch(etags ...string) RESTClient {
+	if len(etags) == 0 {
+		return r.SetHeader("If-None-Match")
+	}
+	return r.SetHeader("If-None-Match", strings.Join(etags, ", "))
+}
+
+func (r *restfulClient) IfUnmodifiedSince(t time.Time) RESTClient {
+	return r.SetHeader("If-Unmodified-Since", t.UTC().Format(http.TimeFormat))
+}
+
 func (r *restfulClient) Retry(backoff backoff.BackOff,
 	shouldRetryFunc func(*http.Response, error) bool) RESTClient {
+	r = r.clone()
 	r.backoff = backoff
+	r.newBackOff = nil
 	r.shouldRetryFunc = shouldRetryFunc
 	return r
 }
 
+func (r *restfulClient) RetryFunc(newBackOff func() backoff.BackOff,
+	shouldRetryFunc func(*http.Response, error) bool) RESTClient {
+	r = r.clone()
+	r.newBackOff = newBackOff
+	r.shouldRetryFunc = shouldRetryFunc
+	return r
+}
+
+// roundTrip sends req by operate and retries it while shouldRetryFunc returns true and the backoff
+// allows it, without shouldRetryFunc req is sent once. An error which isn't retried is returned
+// as it is, and the body of req is replayed from GetBody for every retry
 func (r *restfulClient) roundTrip(req *http.Request, operate func(*http.Request) (*http.Response, error)) (*http.Response, error) {
-	body := req.Body
-	defer body.Close()
-	req.Body = io.NopCloser(body)
 	var (
-		err  error
-		resp *http.Response
+		err     error
+		resp    *http.Response
+		attempt int
+		tried   []string
+		// lastErr is the error of the previous attempt
+		lastErr error
 	)
+	opts := TransportOptionsOf(r.c)
+	budget, bulkhead := opts.RetryBudget, opts.Bulkhead
 	retryOperate := func() error {
-		resp, err = operate(req)
-		if r.shouldRetryFunc != nil && !r.shouldRetryFunc(resp, err) {
+		if attempt > 0 && budget != nil && !budget.Withdraw() {
+			return backoff.Permanent(&RetryBudgetError{Err: lastErr})
+		}
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			// the body of the previous attempt has been consumed
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return backoff.Permanent(bodyErr)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		attempt++
+		attemptReq, endpoint := r.pickEndpoint(attemptReq, tried)
+		if endpoint != "" {
+			tried = append(tried, endpoint)
+		}
+		var attempt *endpointAttempt
+		if len(r.endpoints) != 0 {
+			attempt = &endpointAttempt{r: r, endpoint: endpoint}
+			attemptReq = attemptReq.WithContext(context.WithValue(attemptReq.Context(), endpointAttemptKey{}, attempt))
+		}
+		if md := MetadataFrom(req.Context()); md != nil {
+			md.Endpoint = endpoint
+		}
+		if bulkhead != nil {
+			release, bulkheadErr := bulkhead.Acquire(attemptReq)
+			if bulkheadErr != nil {
+				closeRequestBody(attemptReq)
+				if len(r.endpoints) != 0 {
+					r.balancer().Done(endpoint, nil, bulkheadErr)
+				}
+				return backoff.Permanent(bulkheadErr)
+			}
+			resp, err = operate(attemptReq)
+			if err != nil {
+				release()
+			} else {
+				resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+			}
+		} else {
+			resp, err = operate(attemptReq)
+		}
+		if attempt != nil {
+			// the endpoint of a copy answering instead of the attempt, e.g. by hedging
+			answered := attempt.endpoint
+			if err != nil {
+				r.balancer().Done(answered, nil, err)
+			} else {
+				attemptResp := resp
+				resp.Body = &balancedBody{ReadCloser: resp.Body, done: func(err error) {
+					r.balancer().Done(answered, attemptResp, err)
+				}}
+			}
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			if r.shouldRetryFunc != nil && len(tried) < len(r.endpoints) {
+				// fail over to another endpoint
+				lastErr = fmt.Errorf("attempt failed,%w", err)
+				return lastErr
+			}
+			// retrying can't succeed before the circuit breaker probes the server
+			return backoff.Permanent(err)
+		}
+		if r.shouldRetryFunc == nil || !r.shouldRetryFunc(resp, err) {
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			if budget != nil {
+				budget.Success()
+			}
 			return nil
 		}
-		return fmt.Errorf("attempt failed,%w", err)
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			lastErr = fmt.Errorf("attempt failed,status %d", resp.StatusCode)
+			return lastErr
+		}
+		lastErr = fmt.Errorf("attempt failed,%w", err)
+		return lastErr
 	}
 
-	backOff := backoff.WithContext(r.backoff, req.Context())
+	b := copyBackOff(r.backoff)
+	if r.newBackOff != nil {
+		b = r.newBackOff()
+	}
+	backOff := backoff.WithContext(b, req.Context())
 
 	notify := func(err error, duration time.Duration) {
 		r.From(req.Context()).Warnf("attempt failed,duration %v, retry after %+v", duration, err)
@@ -345,17 +673,84 @@ func (r *restfulClient) roundTrip(req *http.Request, operate func(*http.Request)
 	return resp, nil
 }
 
-func (r *restfulClient) Do(ctx context.Context, result interface{}, opts ...func(*http.Response) error) error {
+// pickEndpoint returns the attempt req and its endpoint, with several endpoints
+// req is redirected to the endpoint picked by the balancer
+func (r *restfulClient) pickEndpoint(req *http.Request, tried []string) (*http.Request, string) {
+	if len(r.endpoints) == 0 {
+		if r.baseURL == nil {
+			return req, ""
+		}
+		return req, endpointOf(r.baseURL)
+	}
+	endpoint := r.balancer().Pick(r.endpoints, tried)
+	baseURL, err := parseEndpoint(endpoint)
+	if err != nil {
+		return req, endpoint
+	}
+	// parse the URL like the one of the request, which is built from its string
+	u, err := url.Parse(r.urlFor(baseURL).String())
+	if err != nil {
+		return req, endpoint
+	}
+	attemptReq := req.Clone(req.Context())
+	attemptReq.URL = u
+	attemptReq.Host = requestHost(u)
+	return attemptReq, endpoint
+}
+
+func (r *restfulClient) balancer() Balancer {
+	if b := TransportOptionsOf(r.c).Balancer; b != nil {
+		return b
+	}
+	return defaultBalancer
+}
+
+// copyBackOff copies the stateful *backoff.ExponentialBackOff, so that concurrent calls of a shared
+// client don't race on it, the other backoffs can't be copied and are returned as they are
+func copyBackOff(b backoff.BackOff) backoff.BackOff {
+	if eb, ok := b.(*backoff.ExponentialBackOff); ok {
+		c := *eb
+		return &c
+	}
+	return b
+}
+
+// send builds the request and sends it with retries, the response is recorded
+// into the Metadata of ctx
+func (r *restfulClient) send(ctx context.Context) (*http.Response, error) {
 	if r.err != nil {
-		return r.err
+		return nil, r.err
+	}
+	if resolver := TransportOptionsOf(r.c).Resolver; resolver != nil {
+		var err error
+		if r, err = r.resolve(ctx, resolver); err != nil {
+			return nil, err
+		}
 	}
 	uri := r.finalURL().String()
-	req, err := r.c.Request().Build(ctx, r.verb, uri, r.body, r.headers)
+	if len(r.resource) != 0 {
+		ctx = context.WithValue(ctx, resourceKey{}, r.resourcePath())
+	}
+	req, err := r.c.Request().Build(ctx, r.verb, uri, r.body, r.requestHeaders())
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if _, ok := unixSocket(req.URL.Hostname()); ok {
+		req.Host = requestHost(req.URL)
+	}
+	resp, err := r.roundTrip(req, r.c.RoundTrip)
+	if err != nil {
+		return nil, err
 	}
-	var resp *http.Response
-	if resp, err = r.roundTrip(req, r.c.RoundTrip); err != nil {
+	if md := MetadataFrom(ctx); md != nil {
+		md.record(resp)
+	}
+	return resp, nil
+}
+
+func (r *restfulClient) Do(ctx context.Context, result interface{}, opts ...func(*http.Response) error) error {
+	resp, err := r.send(ctx)
+	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
@@ -367,55 +762,93 @@ func (r *restfulClient) DoNop(ctx context.Context, opts ...func(*http.Response)
 }
 
 func (r *restfulClient) DoRaw(ctx context.Context) ([]byte, error) {
-	if r.err != nil {
-		return nil, r.err
-	}
-	uri := r.finalURL().String()
-	req, err := r.c.Request().Build(ctx, r.verb, uri, r.body, r.headers)
+	resp, err := r.send(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var resp *http.Response
-	if resp, err = r.roundTrip(req, r.c.RoundTrip); err != nil {
-		return nil, err
-	}
 	defer resp.Body.Close()
 
 	return io.ReadAll(resp.Body)
 }
 
-func (r *restfulClient) Stream(ctx context.Context) (io.ReadCloser, error) {
-	if r.err != nil {
-		return nil, r.err
+func (r *restfulClient) DoString(ctx context.Context) (string, error) {
+	resp, err := r.send(ctx)
+	if err != nil {
+		return "", err
 	}
-	uri := r.finalURL().String()
-	req, err := r.c.Request().Build(ctx, r.verb, uri, r.body, r.headers)
+	defer resp.Body.Close()
+
+	body, err := CharsetReader(resp.Body, resp.Header.Get("Content-Type"))
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	var resp *http.Response
-	if resp, err = r.roundTrip(req, r.c.RoundTrip); err != nil {
+	var sb strings.Builder
+	if _, err = io.Copy(&sb, body); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func (r *restfulClient) Stream(ctx context.Context, opts ...func(*http.Response) error) (io.ReadCloser, error) {
+	resp, err := r.send(ctx)
+	if err != nil {
 		return nil, err
 	}
+	for _, opt := range opts {
+		if err = opt(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
 	return resp.Body, nil
 }
 
+// requestHeaders returns the headers of the request, those set on r replace the defaults key by key
+func (r *restfulClient) requestHeaders() http.Header {
+	return overrideValues(r.defaultHeaders, r.headers)
+}
+
+// resourcePath returns the path of the resource without its name
+func (r *restfulClient) resourcePath() string {
+	p := r.pathPrefix
+	if r.baseURL != nil {
+		p = path.Join(r.baseURL.Path, p)
+	}
+	return path.Join(p, r.parentPath, r.resource)
+}
+
 func (r *restfulClient) finalURL() *url.URL {
+	return r.urlFor(r.baseURL)
+}
+
+// urlFor returns the URL of the request sent to the endpoint baseURL
+func (r *restfulClient) urlFor(baseURL *url.URL) *url.URL {
 	p := r.pathPrefix
+	if len(r.parentPath) != 0 {
+		p = path.Join(p, r.parentPath)
+	}
 	if len(r.resource) != 0 {
 		p = path.Join(p, r.resource)
 	}
-	// Join trims trailing slashes, so preserve r.pathPrefix's trailing slash for backwards compatibility if nothing was changed
-	if len(r.resourceName) != 0 || len(r.subPath) != 0 || len(r.subresource) != 0 {
-		p = path.Join(p, r.resourceName, r.subresource, r.subPath)
-	}
 	finalURL := &url.URL{}
-	if r.baseURL != nil {
-		*finalURL = *r.baseURL
+	if baseURL != nil {
+		*finalURL = *baseURL
+	}
+	if len(r.templatePath) == 0 {
+		// Join trims trailing slashes, so preserve r.pathPrefix's trailing slash for backwards compatibility if nothing was changed
+		if len(r.resourceName) != 0 || len(r.subPath) != 0 || len(r.subresource) != 0 {
+			p = path.Join(p, r.resourceName, r.subresource, r.subPath)
+		}
+		finalURL.Path = path.Join(finalURL.Path, p)
+	} else {
+		// the template is already escaped, build RawPath so that escaped '/' in parameters are preserved,
+		// the suffix stays the last segments
+		p = path.Join(p, r.resourceName, r.subresource)
+		finalURL.RawPath = path.Join(finalURL.EscapedPath(), escapePath(p), r.templatePath, escapePath(r.subPath))
+		finalURL.Path, _ = url.PathUnescape(finalURL.RawPath)
 	}
-	finalURL.Path = path.Join(finalURL.Path, p)
 	query := finalURL.Query()
-	for key, values := range r.params {
+	for key, values := range overrideValues(r.defaultParams, r.params) {
 		for _, value := range values {
 			query.Add(key, value)
 		}
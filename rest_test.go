@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+func TestRESTClientTemplateConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Echo", r.Header.Get("X-Worker")+"/"+r.URL.Query().Get("worker"))
+	}))
+	defer server.Close()
+
+	template := Get().Endpoints(server.URL).Header("X-Project-Id", "p1").Query("limit", "10")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			worker := strconv.Itoa(i)
+			client := template.Resource("books").SetHeader("X-Worker", worker).Query("worker", worker)
+			resp, err := client.(*restfulClient).send(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if got, want := resp.Header.Get("X-Echo"), worker+"/"+worker; got != want {
+				t.Errorf("echo %q, want %q", got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	r := template.(*restfulClient)
+	if r.resource != "" || r.headers.Get("X-Worker") != "" || r.params.Get("worker") != "" {
+		t.Errorf("template modified: resource %q, headers %v, query %v", r.resource, r.headers, r.params)
+	}
+}
+
+func TestRESTClientClone(t *testing.T) {
+	template := Get().Endpoints("http://localhost:80").Header("X-A", "1").Query("a", "1")
+	clone := template.Clone().Header("X-A", "2").Query("a", "2").Endpoints("http://other:80")
+
+	r, c := template.(*restfulClient), clone.(*restfulClient)
+	if got := r.headers.Values("X-A"); len(got) != 1 {
+		t.Errorf("template headers %v", got)
+	}
+	if got := r.params["a"]; len(got) != 1 {
+		t.Errorf("template query %v", got)
+	}
+	if r.baseURL.Host != "localhost:80" || c.baseURL.Host != "other:80" {
+		t.Errorf("endpoints %s, %s", r.baseURL, c.baseURL)
+	}
+}
+
+func TestRESTClientRetryFuncConcurrent(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	template := Get().Endpoints(server.URL).RetryFunc(func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+	}, OnRetryCondition)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := template.DoNop(context.Background()); err == nil {
+				t.Error("expected an error")
+			}
+		}()
+	}
+	wg.Wait()
+	// every call has its own backoff allowing 2 retries
+	if got := atomic.LoadInt32(&calls); got != 8*3 {
+		t.Errorf("%d calls, want %d", got, 8*3)
+	}
+}
+
+func TestRESTClientRetryExponentialConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 0
+	b.MaxElapsedTime = 0
+	b.Multiplier = 1
+	template := Get().Endpoints(server.URL).Retry(b, func(resp *http.Response, err error) bool {
+		return false
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = template.DoNop(context.Background())
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+func TestRoundTripRetry(t *testing.T) {
+	errDial := errors.New("dial failed")
+	tests := []struct {
+		name        string
+		responses   []int
+		err         error
+		shouldRetry func(*http.Response, error) bool
+		wantCalls   int32
+		wantStatus  int
+		wantErr     string
+	}{
+		{
+			name:       "sent once without shouldRetryFunc",
+			responses:  []int{http.StatusBadGateway, http.StatusOK},
+			wantCalls:  1,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:      "error without shouldRetryFunc",
+			err:       errDial,
+			wantCalls: 1,
+			wantErr:   errDial.Error(),
+		},
+		{
+			name:        "retried status",
+			responses:   []int{http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusOK},
+			shouldRetry: OnRetryCondition,
+			wantCalls:   3,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "error not retried",
+			err:         errDial,
+			shouldRetry: OnRetryCondition,
+			wantCalls:   1,
+			wantErr:     errDial.Error(),
+		},
+		{
+			name:        "retries exhausted",
+			responses:   []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			shouldRetry: OnRetryCondition,
+			wantCalls:   3,
+			wantErr:     "attempt failed,status 502",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				n := atomic.AddInt32(&calls, 1)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &http.Response{
+					StatusCode: tt.responses[n-1],
+					Header:     make(http.Header),
+					Body:       io.NopCloser(strings.NewReader("")),
+					Request:    req,
+				}, nil
+			})
+			client := DefaultTransport.WithClient(rt).Method(http.MethodGet).Endpoints("http://localhost:80")
+			if tt.shouldRetry != nil {
+				client = client.RetryFunc(func() backoff.BackOff {
+					return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+				}, tt.shouldRetry)
+			}
+			resp, err := client.(*restfulClient).send(context.Background())
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("%d calls, want %d", got, tt.wantCalls)
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRoundTripRetryReplaysBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	err := Post().Endpoints(server.URL).Body(map[string]string{"name": "a"}).
+		Retry(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3), OnRetryCondition).
+		DoNop(context.Background(), ErrorFunc(http.StatusOK))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("%d attempts, want 3", len(bodies))
+	}
+	for i, body := range bodies {
+		if body != `{"name":"a"}` {
+			t.Errorf("attempt %d sent %q", i, body)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
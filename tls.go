@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSOptions configures the TLS config created by NewTLSConfig
+type TLSOptions struct {
+	// CAFile is the PEM bundle of the CAs verifying the servers, the system CAs by default
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key
+	CertFile string
+	KeyFile  string
+	// MinVersion is the minimum TLS version, TLS 1.2 by default
+	MinVersion uint16
+	// ServerName is the name verified in the server certificate and sent in SNI, the host by default.
+	// With CAFile, it must be set to dial an IP address or a unix socket, which don't tell the name to verify
+	ServerName string
+	// PinnedSPKI are the SPKIHash of which one must be in the certificate chain of the server
+	PinnedSPKI []string
+	// ReloadInterval is the interval of the checks of the files modification, 1 minute by default
+	ReloadInterval time.Duration
+}
+
+// WithTLSConfig sets the TLS config of the transport
+func WithTLSConfig(config *tls.Config) HTTPTransportOption {
+	return func(t *http.Transport) {
+		t.TLSClientConfig = config
+	}
+}
+
+// SPKIHash returns the base64 encoded SHA-256 of the SubjectPublicKeyInfo of cert, used to pin it
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewTLSConfig returns a TLS config of opts, the CA bundle and the client certificate are
+// read again when their files are modified, so that they can be rotated without recreating
+// the transport. e.g.
+//
+//	config, err := rest.NewTLSConfig(rest.TLSOptions{CAFile: "ca.pem", CertFile: "tls.crt", KeyFile: "tls.key"})
+//	transport := rest.DefaultTransport.WithClient(rest.NewHTTPTransport(rest.WithTLSConfig(config)))
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("the client certificate and key must be set together")
+	}
+	if opts.MinVersion == 0 {
+		opts.MinVersion = tls.VersionTLS12
+	}
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = time.Minute
+	}
+	r := &tlsReloader{opts: opts, now: time.Now}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.checked = r.now()
+	pins := make(map[string]bool, len(opts.PinnedSPKI))
+	for _, pin := range opts.PinnedSPKI {
+		pins[strings.TrimPrefix(pin, "sha256/")] = true
+	}
+	r.pins = pins
+
+	config := &tls.Config{
+		MinVersion: opts.MinVersion,
+		ServerName: opts.ServerName,
+	}
+	if opts.CertFile != "" {
+		config.GetClientCertificate = r.clientCertificate
+	}
+	if opts.CAFile != "" {
+		// the standard verification can't follow the reloads of the CAs, so it is done by VerifyConnection
+		config.InsecureSkipVerify = true
+	}
+	if opts.CAFile != "" || len(pins) != 0 {
+		config.VerifyConnection = r.verifyConnection
+	}
+	return config, nil
+}
+
+type tlsReloader struct {
+	opts TLSOptions
+	pins map[string]bool
+	now  func() time.Time
+
+	mu      sync.Mutex
+	checked time.Time
+	modTime map[string]time.Time
+	roots   *x509.CertPool
+	cert    *tls.Certificate
+}
+
+// load reads the files
+func (r *tlsReloader) load() error {
+	modTime := make(map[string]time.Time, 3)
+	for _, name := range []string{r.opts.CAFile, r.opts.CertFile, r.opts.KeyFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		modTime[name] = info.ModTime()
+	}
+	var roots *x509.CertPool
+	if r.opts.CAFile != "" {
+		data, err := os.ReadFile(r.opts.CAFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in %s", r.opts.CAFile)
+		}
+	}
+	var cert *tls.Certificate
+	if r.opts.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	r.modTime, r.roots, r.cert = modTime, roots, cert
+	return nil
+}
+
+// reload reads the files again if they were modified, the previous content is kept if they are invalid
+func (r *tlsReloader) reload() {
+	now := r.now()
+	if now.Sub(r.checked) < r.opts.ReloadInterval {
+		return
+	}
+	r.checked = now
+	for name, modTime := range r.modTime {
+		if info, err := os.Stat(name); err == nil && !info.ModTime().Equal(modTime) {
+			_ = r.load()
+			return
+		}
+	}
+}
+
+func (r *tlsReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	return r.cert, nil
+}
+
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState) error {
+	r.mu.Lock()
+	r.reload()
+	roots := r.roots
+	r.mu.Unlock()
+
+	chains := cs.VerifiedChains
+	if roots != nil {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no server certificate")
+		}
+		// x509 skips the verification of the host without DNSName, which would accept
+		// any certificate of the CAs
+		if cs.ServerName == "" {
+			return errors.New("no server name to verify the server certificate, set TLSOptions.ServerName")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		var err error
+		chains, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(r.pins) == 0 {
+		return nil
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if r.pins[SPKIHash(cert)] {
+				return nil
+			}
+		}
+	}
+	return errors.New("no pinned public key in the server certificate chain")
+}
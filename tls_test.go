@@ -0,0 +1,202 @@
+package rest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a server certificate for localhost and 127.0.0.1
+func (ca *testCA) issue(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}
+}
+
+func (ca *testCA) writePEM(t *testing.T, name string) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTLSTestServer(t *testing.T, cert tls.Certificate) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	// the rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	return server
+}
+
+func getTLS(config *tls.Config, url string) error {
+	transport := NewHTTPTransport(WithTLSConfig(config))
+	defer transport.CloseIdleConnections()
+	return DefaultTransport.WithClient(transport).Method(http.MethodGet).Endpoints(url).
+		DoNop(context.Background())
+}
+
+func TestTLSConfigVerify(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	server := newTLSTestServer(t, ca.issue(t))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca.writePEM(t, caFile)
+
+	tests := []struct {
+		name    string
+		opts    TLSOptions
+		ip      bool
+		wantErr bool
+	}{
+		{name: "trusted", opts: TLSOptions{CAFile: caFile}},
+		{name: "ip without server name", opts: TLSOptions{CAFile: caFile}, ip: true, wantErr: true},
+		{name: "ip with server name", opts: TLSOptions{CAFile: caFile, ServerName: "localhost"}, ip: true},
+		{name: "wrong server name", opts: TLSOptions{CAFile: caFile, ServerName: "books.example"}, wantErr: true},
+		{name: "pinned CA", opts: TLSOptions{CAFile: caFile, PinnedSPKI: []string{"sha256/" + SPKIHash(ca.cert)}}},
+		{name: "pin mismatch", opts: TLSOptions{CAFile: caFile, PinnedSPKI: []string{SPKIHash(other.cert)}}, wantErr: true},
+		{name: "untrusted", opts: TLSOptions{PinnedSPKI: []string{SPKIHash(ca.cert)}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewTLSConfig(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			url := server.URL
+			if !tt.ip {
+				url = strings.Replace(url, "127.0.0.1", "localhost", 1)
+			}
+			if err = getTLS(config, url); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSConfigWithoutServerName(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca.writePEM(t, caFile)
+	config, err := NewTLSConfig(TLSOptions{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a certificate of a trusted CA is not enough without a name to verify
+	if err = config.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}); err == nil {
+		t.Error("expected an error without server name")
+	}
+	state := tls.ConnectionState{ServerName: "localhost", PeerCertificates: []*x509.Certificate{leaf}}
+	if err = config.VerifyConnection(state); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	ca, rotated := newTestCA(t), newTestCA(t)
+	server := newTLSTestServer(t, rotated.issue(t))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca.writePEM(t, caFile)
+
+	config, err := NewTLSConfig(TLSOptions{CAFile: caFile, ReloadInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if err = getTLS(config, url); err == nil {
+		t.Fatal("expected an error before the CA rotates")
+	}
+	rotated.writePEM(t, caFile)
+	modTime := time.Now().Add(time.Minute)
+	if err = os.Chtimes(caFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if err = getTLS(config, url); err != nil {
+		t.Fatalf("after the CA rotates: %v", err)
+	}
+
+	// an invalid bundle keeps the previous CAs
+	if err = os.WriteFile(caFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime = modTime.Add(time.Minute)
+	if err = os.Chtimes(caFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err = getTLS(config, url); err != nil {
+		t.Errorf("after an invalid bundle: %v", err)
+	}
+}
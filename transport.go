@@ -2,6 +2,8 @@ package rest
 
 import (
 	"net/http"
+	"net/url"
+	"sync"
 )
 
 type Transport interface {
@@ -17,13 +19,176 @@ type Transport interface {
 	Method(string) RESTClient
 }
 
+// TransportOptions are the defaults of the clients created from a transport
+type TransportOptions struct {
+	// Encoder encodes the values given to Querys instead of the default *schema.Encoder
+	Encoder Encoder
+	// Headers are the default headers, the values set on a client replace them key by key
+	Headers http.Header
+	// Querys are the default query parameters, the values set on a client replace them key by key
+	Querys url.Values
+	// UserAgent is the default User-Agent
+	UserAgent string
+	// Balancer picks the endpoint of the clients given several endpoints
+	Balancer Balancer
+	// RetryBudget is shared by the retries of the clients
+	RetryBudget *RetryBudget
+	// Bulkhead limits the requests in flight of the clients
+	Bulkhead *Bulkhead
+	// Resolver resolves the endpoints of the clients
+	Resolver Resolver
+}
+
+// OptionsTransport is a Transport carrying TransportOptions, like those of NewTransporter,
+// the other transports are wrapped by ConfigureTransport
+type OptionsTransport interface {
+	Transport
+	// WithOptions returns a copy of the transport with opts
+	WithOptions(opts TransportOptions) Transport
+	Options() TransportOptions
+}
+
+// TransportOption changes the options of a transport
+type TransportOption func(*TransportOptions)
+
+// WithEncoder sets the encoder used by Querys of the clients
+func WithEncoder(encoder Encoder) TransportOption {
+	return func(o *TransportOptions) {
+		o.Encoder = encoder
+	}
+}
+
+// WithHeaders sets default headers of the clients, keys already set are replaced
+func WithHeaders(header http.Header) TransportOption {
+	return func(o *TransportOptions) {
+		h := canonicalHeader(o.Headers)
+		setValues(h, canonicalHeader(header))
+		o.Headers = h
+	}
+}
+
+// WithQuerys sets default query parameters of the clients, keys already set are replaced
+func WithQuerys(query url.Values) TransportOption {
+	return func(o *TransportOptions) {
+		q := make(url.Values, len(o.Querys)+len(query))
+		setValues(q, o.Querys)
+		setValues(q, query)
+		o.Querys = q
+	}
+}
+
+// WithUserAgent sets the default User-Agent of the clients
+func WithUserAgent(userAgent string) TransportOption {
+	return func(o *TransportOptions) {
+		o.UserAgent = userAgent
+	}
+}
+
+// WithBalancer sets the balancer picking the endpoint of the clients given several endpoints
+func WithBalancer(balancer Balancer) TransportOption {
+	return func(o *TransportOptions) {
+		o.Balancer = balancer
+	}
+}
+
+// WithRetryBudget sets the budget shared by the retries of the clients
+func WithRetryBudget(budget *RetryBudget) TransportOption {
+	return func(o *TransportOptions) {
+		o.RetryBudget = budget
+	}
+}
+
+// WithBulkhead sets the limit of the requests in flight of the clients
+func WithBulkhead(bulkhead *Bulkhead) TransportOption {
+	return func(o *TransportOptions) {
+		o.Bulkhead = bulkhead
+	}
+}
+
+// WithResolver sets the resolver of the endpoints of the clients
+func WithResolver(resolver Resolver) TransportOption {
+	return func(o *TransportOptions) {
+		o.Resolver = resolver
+	}
+}
+
+// ConfigureTransport returns a copy of t with opts applied to its options
+func ConfigureTransport(t Transport, opts ...TransportOption) Transport {
+	options := TransportOptionsOf(t)
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if ot, ok := t.(OptionsTransport); ok {
+		return ot.WithOptions(options)
+	}
+	return &optionsTransport{Transport: t, opts: options}
+}
+
+// TransportOptionsOf returns the options of t, which has none unless it is an OptionsTransport
+func TransportOptionsOf(t Transport) TransportOptions {
+	if ot, ok := t.(OptionsTransport); ok {
+		return ot.Options()
+	}
+	return TransportOptions{}
+}
+
+// optionsTransport adds options to a transport which isn't an OptionsTransport
+type optionsTransport struct {
+	Transport
+	opts TransportOptions
+}
+
+func (t *optionsTransport) WithRequest(requester Requester) Transport {
+	return &optionsTransport{Transport: t.Transport.WithRequest(requester), opts: t.opts}
+}
+
+func (t *optionsTransport) WithClient(roundTripper http.RoundTripper) Transport {
+	return &optionsTransport{Transport: t.Transport.WithClient(roundTripper), opts: t.opts}
+}
+
+func (t *optionsTransport) WithResponse(response Response) Transport {
+	return &optionsTransport{Transport: t.Transport.WithResponse(response), opts: t.opts}
+}
+
+func (t *optionsTransport) WithOptions(opts TransportOptions) Transport {
+	return &optionsTransport{Transport: t.Transport, opts: opts}
+}
+
+func (t *optionsTransport) Options() TransportOptions {
+	return t.opts
+}
+
+func (t *optionsTransport) Method(method string) RESTClient {
+	return NewRESTClient(t, method)
+}
+
 // DefaultTransport 默认配置的传输层实现
-var DefaultTransport = NewTransporter(JsonRequest{}, http.DefaultTransport, JsonResponse{})
+var DefaultTransport = NewTransporter(JsonRequest{}, defaultRoundTripper{}, JsonResponse{})
+
+var (
+	unixTransportOnce sync.Once
+	unixTransport     *http.Transport
+)
+
+// defaultRoundTripper sends the requests by http.DefaultTransport as it is when they are sent,
+// only the requests to a unix socket are sent by a transport of NewHTTPTransport
+type defaultRoundTripper struct{}
+
+func (defaultRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := unixSocket(req.URL.Hostname()); ok {
+		unixTransportOnce.Do(func() {
+			unixTransport = NewHTTPTransport()
+		})
+		return unixTransport.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
 
 type transporter struct {
 	req          Requester
 	roundTripper http.RoundTripper
 	resp         Response
+	opts         TransportOptions
 }
 
 func NewTransporter(req Requester, roundTripper http.RoundTripper, resp Response) Transport {
@@ -63,27 +228,27 @@ func (t *transporter) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 func (t *transporter) WithRequest(requester Requester) Transport {
-	return &transporter{
-		req:          requester,
-		roundTripper: t.roundTripper,
-		resp:         t.resp,
-	}
+	c := *t
+	c.req = requester
+	return &c
 }
 
 func (t *transporter) WithClient(roundTripper http.RoundTripper) Transport {
-	return &transporter{
-		req:          t.req,
-		roundTripper: roundTripper,
-		resp:         t.resp,
-	}
+	c := *t
+	c.roundTripper = roundTripper
+	return &c
 }
 
 func (t *transporter) WithResponse(response Response) Transport {
-	return &transporter{
-		req:          t.req,
-		roundTripper: t.roundTripper,
-		resp:         response,
-	}
+	c := *t
+	c.resp = response
+	return &c
+}
+
+func (t *transporter) WithOptions(opts TransportOptions) Transport {
+	c := *t
+	c.opts = opts
+	return &c
 }
 
 func (t *transporter) Request() Requester {
@@ -98,6 +263,10 @@ func (t *transporter) Client() http.RoundTripper {
 	return t.roundTripper
 }
 
+func (t *transporter) Options() TransportOptions {
+	return t.opts
+}
+
 func (t *transporter) Method(method string) RESTClient {
 	return NewRESTClient(t, method)
 }
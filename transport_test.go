@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestTransportDefaults(t *testing.T) {
+	var (
+		header http.Header
+		query  url.Values
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header, query = r.Header, r.URL.Query()
+	}))
+	defer server.Close()
+
+	transport := ConfigureTransport(DefaultTransport,
+		WithHeaders(http.Header{"x-project-id": {"p1"}, "Accept-Language": {"en"}}),
+		WithQuerys(url.Values{"limit": {"10"}, "region": {"a"}}),
+		WithUserAgent("gateway/1.0"))
+	tests := []struct {
+		name       string
+		build      func(RESTClient) RESTClient
+		wantHeader http.Header
+		wantQuery  url.Values
+	}{
+		{
+			name:       "defaults",
+			build:      func(r RESTClient) RESTClient { return r },
+			wantHeader: http.Header{"X-Project-Id": {"p1"}, "Accept-Language": {"en"}, "User-Agent": {"gateway/1.0"}},
+			wantQuery:  url.Values{"limit": {"10"}, "region": {"a"}},
+		},
+		{
+			name: "add replaces the default of the key",
+			build: func(r RESTClient) RESTClient {
+				return r.Header("X-Project-Id", "p2").Query("limit", "20")
+			},
+			wantHeader: http.Header{"X-Project-Id": {"p2"}, "Accept-Language": {"en"}, "User-Agent": {"gateway/1.0"}},
+			wantQuery:  url.Values{"limit": {"20"}, "region": {"a"}},
+		},
+		{
+			name: "merge replaces the default of the key",
+			build: func(r RESTClient) RESTClient {
+				return r.Headers(http.Header{"User-Agent": {"cli/2.0"}}).Querys(url.Values{"region": {"b"}})
+			},
+			wantHeader: http.Header{"X-Project-Id": {"p1"}, "Accept-Language": {"en"}, "User-Agent": {"cli/2.0"}},
+			wantQuery:  url.Values{"limit": {"10"}, "region": {"b"}},
+		},
+		{
+			name: "delete the default",
+			build: func(r RESTClient) RESTClient {
+				return r.Header("Accept-Language").SetQuery("region")
+			},
+			wantHeader: http.Header{"X-Project-Id": {"p1"}, "User-Agent": {"gateway/1.0"}},
+			wantQuery:  url.Values{"limit": {"10"}},
+		},
+		{
+			name: "replace discards the defaults",
+			build: func(r RESTClient) RESTClient {
+				return r.ReplaceHeaders(http.Header{"X-A": {"1"}}).ReplaceQuerys(url.Values{"a": {"1"}})
+			},
+			wantHeader: http.Header{"X-A": {"1"}},
+			wantQuery:  url.Values{"a": {"1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.build(transport.Method(http.MethodGet).Endpoints(server.URL)).
+				DoNop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.wantHeader {
+				if got := header.Values(key); !reflect.DeepEqual(got, want) {
+					t.Errorf("header %s %v, want %v", key, got, want)
+				}
+			}
+			for _, key := range []string{"X-Project-Id", "Accept-Language"} {
+				if _, ok := tt.wantHeader[key]; !ok && header.Get(key) != "" {
+					t.Errorf("header %s %v, want none", key, header.Values(key))
+				}
+			}
+			if !reflect.DeepEqual(query, tt.wantQuery) {
+				t.Errorf("query %v, want %v", query, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestHandlerDefaults(t *testing.T) {
+	transport := ConfigureTransport(DefaultTransport,
+		WithHeaders(http.Header{"X-Project-Id": {"p1"}, "X-Region": {"a"}}), WithUserAgent("gateway/1.0"))
+	handler := NewHandler(WithTransport(transport)).
+		Endpoint("http://localhost:80").
+		Header("X-Project-Id", "p2").
+		UserAgent("books/1.0")
+	r := handler.To().Method(http.MethodGet).(*restfulClient)
+	want := http.Header{"X-Project-Id": {"p2"}, "X-Region": {"a"}, "User-Agent": {"books/1.0"}}
+	if got := r.requestHeaders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("headers %v, want %v", got, want)
+	}
+	// the transport of the handler is left unchanged
+	if got := TransportOptionsOf(transport).Headers.Get("X-Project-Id"); got != "p1" {
+		t.Errorf("transport X-Project-Id %q", got)
+	}
+}
+
+// plainTransport implements Transport without options
+type plainTransport struct {
+	Transport
+}
+
+func (t plainTransport) WithClient(roundTripper http.RoundTripper) Transport {
+	return plainTransport{t.Transport.WithClient(roundTripper)}
+}
+
+func (t plainTransport) Method(method string) RESTClient {
+	return NewRESTClient(t, method)
+}
+
+func TestConfigureTransportWraps(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer server.Close()
+
+	plain := plainTransport{NewTransporter(JsonRequest{}, http.DefaultTransport, JsonResponse{})}
+	if _, ok := Transport(plain).(OptionsTransport); ok {
+		t.Fatal("plainTransport must not carry options")
+	}
+	transport := ConfigureTransport(plain, WithUserAgent("gateway/1.0")).WithClient(http.DefaultTransport)
+	if got := TransportOptionsOf(transport).UserAgent; got != "gateway/1.0" {
+		t.Fatalf("user agent %q after WithClient", got)
+	}
+	if err := transport.Method(http.MethodGet).Endpoints(server.URL).DoNop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "gateway/1.0" {
+		t.Errorf("user agent %q", userAgent)
+	}
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// unixHostSuffix ends the hosts of the URLs sent over a unix socket, which is hex encoded before it
+const unixHostSuffix = ".unix"
+
+// parseEndpoint parses endpoint, the endpoints on a unix socket like unix:///var/run/app.sock/v1
+// or http+unix://%2Fvar%2Frun%2Fapp.sock/v1 are turned into http URLs whose host is dialed
+// on the socket by the transports of NewHTTPTransport
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		socket, p := splitSocketPath(u.Path)
+		return unixURL(socket, p, u), nil
+	case strings.HasPrefix(endpoint, "http+unix://"):
+		rest := strings.TrimPrefix(endpoint, "http+unix://")
+		host, p := rest, ""
+		if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+			host, p = rest[:i], rest[i:]
+		}
+		socket, err := url.PathUnescape(host)
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		return unixURL(socket, u.Path, u), nil
+	}
+	return url.Parse(endpoint)
+}
+
+// splitSocketPath splits the path of a unix:// URL after its segment ending with .sock,
+// the whole path is the socket if there is none
+func splitSocketPath(p string) (socket, httpPath string) {
+	for i := 0; i < len(p); {
+		next := strings.IndexByte(p[i+1:], '/')
+		end := len(p)
+		if next >= 0 {
+			end = i + 1 + next
+		}
+		if strings.HasSuffix(p[i:end], ".sock") {
+			return p[:end], p[end:]
+		}
+		i = end
+	}
+	return p, ""
+}
+
+func unixURL(socket, p string, u *url.URL) *url.URL {
+	return &url.URL{
+		Scheme:   "http",
+		Host:     hex.EncodeToString([]byte(socket)) + unixHostSuffix,
+		Path:     p,
+		RawQuery: u.RawQuery,
+		Fragment: u.Fragment,
+	}
+}
+
+// endpointOf returns the endpoint parsed into baseURL by parseEndpoint
+func endpointOf(baseURL *url.URL) string {
+	socket, ok := unixSocket(baseURL.Hostname())
+	if !ok {
+		return baseURL.String()
+	}
+	u := url.URL{Path: baseURL.Path, RawQuery: baseURL.RawQuery, Fragment: baseURL.Fragment}
+	if strings.HasSuffix(socket, ".sock") && !strings.Contains(socket[:len(socket)-len(".sock")], ".sock/") {
+		return "unix://" + socket + u.String()
+	}
+	return "http+unix://" + url.PathEscape(socket) + u.String()
+}
+
+// unixSocket returns the socket of a host made by unixURL
+func unixSocket(host string) (string, bool) {
+	if !strings.HasSuffix(host, unixHostSuffix) {
+		return "", false
+	}
+	socket, err := hex.DecodeString(strings.TrimSuffix(host, unixHostSuffix))
+	if err != nil {
+		return "", false
+	}
+	return string(socket), true
+}
+
+// requestHost returns the Host header of a request to u, localhost for a unix socket
+func requestHost(u *url.URL) string {
+	if _, ok := unixSocket(u.Hostname()); ok {
+		return "localhost"
+	}
+	return u.Host
+}
+
+// unixDialContext wraps dial to dial the unix socket of the hosts made by unixURL
+func unixDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			if socket, ok := unixSocket(host); ok {
+				return dial(ctx, "unix", socket)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint   string
+		wantSocket string
+		wantPath   string
+		// wantEndpoint is the endpoint given back by endpointOf, the endpoint by default
+		wantEndpoint string
+	}{
+		{endpoint: "http://localhost:80/v1", wantPath: "/v1"},
+		{endpoint: "unix:///var/run/app.sock/v1", wantSocket: "/var/run/app.sock", wantPath: "/v1"},
+		{endpoint: "unix:///var/run/app.sock", wantSocket: "/var/run/app.sock"},
+		{endpoint: "unix:///var/run/app", wantSocket: "/var/run/app",
+			wantEndpoint: "http+unix://%2Fvar%2Frun%2Fapp"},
+		{endpoint: "http+unix://%2Fvar%2Frun%2Fapp.sock/v1?a=1", wantSocket: "/var/run/app.sock", wantPath: "/v1",
+			wantEndpoint: "unix:///var/run/app.sock/v1?a=1"},
+		{endpoint: "http+unix://%2Fvar%2Frun%2Fapp/v1", wantSocket: "/var/run/app", wantPath: "/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			u, err := parseEndpoint(tt.endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			socket, _ := unixSocket(u.Hostname())
+			if socket != tt.wantSocket || u.Path != tt.wantPath {
+				t.Errorf("socket %q, path %q", socket, u.Path)
+			}
+			want := tt.wantEndpoint
+			if want == "" {
+				want = tt.endpoint
+			}
+			if got := endpointOf(u); got != want {
+				t.Errorf("endpoint %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDefaultTransportUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "app.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	var host, path string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, path = r.Host, r.URL.Path
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	var md Metadata
+	endpoint := "unix://" + socket + "/v1"
+	err = Get().Endpoints(endpoint).Resource("books").DoNop(WithMetadata(context.Background(), &md))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "localhost" || path != "/v1/books" {
+		t.Errorf("host %q, path %q", host, path)
+	}
+	if md.Endpoint != endpoint {
+		t.Errorf("endpoint %q, want %q", md.Endpoint, endpoint)
+	}
+}
+
+func TestDefaultTransportFollowsHTTPDefaultTransport(t *testing.T) {
+	var called bool
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+		return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}, nil
+	})
+	defer func() {
+		http.DefaultTransport = defaultTransport
+	}()
+	if err := Get().Endpoints("http://localhost:1").DoNop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Error("the replaced http.DefaultTransport was not used")
+	}
+}
@@ -0,0 +1,66 @@
+package rest
+
+import "net/http"
+
+// mergeValues adds the values of src which are not yet present in dst,
+// the order of the values of a key is preserved, dst must not be nil
+func mergeValues(dst, src map[string][]string) {
+	for key, srcValues := range src {
+		dstValues := dst[key]
+	next:
+		for _, srcValue := range srcValues {
+			for _, dstValue := range dstValues {
+				if srcValue == dstValue {
+					continue next
+				}
+			}
+			dstValues = append(dstValues, srcValue)
+		}
+		if len(dstValues) != 0 {
+			dst[key] = dstValues
+		}
+	}
+}
+
+// setValues replaces the values of dst by those of src key by key, keys only present in dst are kept,
+// dst must not be nil
+func setValues(dst, src map[string][]string) {
+	for key, values := range src {
+		dst[key] = append([]string(nil), values...)
+	}
+}
+
+// overrideValues returns the values of defaults replaced key by key by those of values,
+// a key of values without value deletes it
+func overrideValues(defaults, values map[string][]string) map[string][]string {
+	c := make(map[string][]string, len(defaults)+len(values))
+	setValues(c, defaults)
+	for key, v := range values {
+		if len(v) == 0 {
+			delete(c, key)
+			continue
+		}
+		c[key] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// cloneValues returns a deep copy of src, nil if src is empty
+func cloneValues(src map[string][]string) map[string][]string {
+	if len(src) == 0 {
+		return nil
+	}
+	c := make(map[string][]string, len(src))
+	setValues(c, src)
+	return c
+}
+
+// canonicalHeader returns a copy of header with canonical keys
+func canonicalHeader(header http.Header) http.Header {
+	c := make(http.Header, len(header))
+	for key, values := range header {
+		key = http.CanonicalHeaderKey(key)
+		c[key] = append(c[key], values...)
+	}
+	return c
+}
@@ -0,0 +1,183 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string][]string
+		src  map[string][]string
+		want map[string][]string
+	}{
+		{
+			name: "new key",
+			dst:  map[string][]string{"a": {"1"}},
+			src:  map[string][]string{"b": {"2"}},
+			want: map[string][]string{"a": {"1"}, "b": {"2"}},
+		},
+		{
+			name: "values appended in order",
+			dst:  map[string][]string{"a": {"1"}},
+			src:  map[string][]string{"a": {"3", "2"}},
+			want: map[string][]string{"a": {"1", "3", "2"}},
+		},
+		{
+			name: "present values not added twice",
+			dst:  map[string][]string{"a": {"1", "2"}},
+			src:  map[string][]string{"a": {"2", "1", "3"}},
+			want: map[string][]string{"a": {"1", "2", "3"}},
+		},
+		{
+			name: "empty source key ignored",
+			dst:  map[string][]string{},
+			src:  map[string][]string{"a": nil},
+			want: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeValues(tt.dst, tt.src)
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("got %v, want %v", tt.dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalHeader(t *testing.T) {
+	got := canonicalHeader(http.Header{"x-a": {"1"}, "X-A": {"2"}, "content-type": {"json"}})
+	if v := got["X-A"]; len(v) != 2 {
+		t.Errorf("X-A %v, want both values", v)
+	}
+	if v := got["Content-Type"]; !reflect.DeepEqual(v, []string{"json"}) {
+		t.Errorf("Content-Type %v", v)
+	}
+	if len(got) != 2 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestHeaderPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(RESTClient) RESTClient
+		want  []string
+	}{
+		{
+			name:  "add keeps earlier values",
+			build: func(r RESTClient) RESTClient { return r.Header("X-A", "1").Header("X-A", "2") },
+			want:  []string{"1", "2"},
+		},
+		{
+			name:  "set replaces earlier values",
+			build: func(r RESTClient) RESTClient { return r.Header("X-A", "1").SetHeader("X-A", "2") },
+			want:  []string{"2"},
+		},
+		{
+			name:  "add after set",
+			build: func(r RESTClient) RESTClient { return r.SetHeader("X-A", "1").Header("X-A", "2") },
+			want:  []string{"1", "2"},
+		},
+		{
+			name: "merge keeps earlier values without duplicates",
+			build: func(r RESTClient) RESTClient {
+				return r.Header("X-A", "1").Headers(http.Header{"x-a": {"1", "2"}})
+			},
+			want: []string{"1", "2"},
+		},
+		{
+			name: "replace discards earlier values",
+			build: func(r RESTClient) RESTClient {
+				return r.Header("X-A", "1").Header("X-B", "1").ReplaceHeaders(http.Header{"X-A": {"2"}})
+			},
+			want: []string{"2"},
+		},
+		{
+			name: "set after replace",
+			build: func(r RESTClient) RESTClient {
+				return r.ReplaceHeaders(http.Header{"X-A": {"1"}}).SetHeader("X-A", "2")
+			},
+			want: []string{"2"},
+		},
+		{
+			name:  "delete",
+			build: func(r RESTClient) RESTClient { return r.Header("X-A", "1").Header("X-A") },
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.build(Get()).(*restfulClient)
+			if got := r.headers.Values("X-A"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("X-A %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryPrecedence(t *testing.T) {
+	type opts struct {
+		A []string `form:"a"`
+	}
+	tests := []struct {
+		name  string
+		build func(RESTClient) RESTClient
+		want  []string
+	}{
+		{
+			name:  "add keeps earlier values",
+			build: func(r RESTClient) RESTClient { return r.Query("a", "1").Query("a", "2") },
+			want:  []string{"1", "2"},
+		},
+		{
+			name:  "set replaces earlier values",
+			build: func(r RESTClient) RESTClient { return r.Query("a", "1").SetQuery("a", "2") },
+			want:  []string{"2"},
+		},
+		{
+			name:  "merge keeps earlier values without duplicates",
+			build: func(r RESTClient) RESTClient { return r.Query("a", "1").Querys(opts{A: []string{"1", "2"}}) },
+			want:  []string{"1", "2"},
+		},
+		{
+			name: "merge url.Values",
+			build: func(r RESTClient) RESTClient {
+				return r.Query("a", "1").Querys(url.Values{"a": {"2"}})
+			},
+			want: []string{"1", "2"},
+		},
+		{
+			name: "replace discards earlier values",
+			build: func(r RESTClient) RESTClient {
+				return r.Query("a", "1").Query("b", "1").ReplaceQuerys(opts{A: []string{"2"}})
+			},
+			want: []string{"2"},
+		},
+		{
+			name:  "add after replace",
+			build: func(r RESTClient) RESTClient { return r.ReplaceQuerys(opts{A: []string{"1"}}).Query("a", "2") },
+			want:  []string{"1", "2"},
+		},
+		{
+			name:  "delete",
+			build: func(r RESTClient) RESTClient { return r.Query("a", "1").Query("a") },
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.build(Get()).(*restfulClient)
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if got := r.params["a"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("a %v, want %v", got, tt.want)
+			}
+		})
+	}
+}